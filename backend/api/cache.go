@@ -0,0 +1,80 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// responseCache keeps recent model responses keyed by prompt so they can be
+// served when Gemini is unavailable
+type responseCache struct {
+	mu         sync.Mutex
+	entries    map[string]cacheEntry
+	ttl        time.Duration
+	maxEntries int
+}
+
+type cacheEntry struct {
+	value    string
+	storedAt time.Time
+}
+
+func newResponseCache(maxEntries int, ttl time.Duration) *responseCache {
+	return &responseCache{
+		entries:    make(map[string]cacheEntry),
+		ttl:        ttl,
+		maxEntries: maxEntries,
+	}
+}
+
+func cacheKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get returns the cached value for key if it exists and hasn't expired
+func (rc *responseCache) Get(key string) (string, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	k := cacheKey(key)
+	entry, ok := rc.entries[k]
+	if !ok {
+		return "", false
+	}
+	if rc.ttl > 0 && time.Since(entry.storedAt) > rc.ttl {
+		delete(rc.entries, k)
+		return "", false
+	}
+	return entry.value, true
+}
+
+// Set stores value under key, evicting the oldest entry when the cache is full
+func (rc *responseCache) Set(key, value string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	k := cacheKey(key)
+	if _, exists := rc.entries[k]; !exists && len(rc.entries) >= rc.maxEntries {
+		var oldestKey string
+		var oldest time.Time
+		for ek, entry := range rc.entries {
+			if oldestKey == "" || entry.storedAt.Before(oldest) {
+				oldestKey = ek
+				oldest = entry.storedAt
+			}
+		}
+		delete(rc.entries, oldestKey)
+	}
+	rc.entries[k] = cacheEntry{value: value, storedAt: time.Now()}
+}
+
+// Len returns the number of cached entries
+func (rc *responseCache) Len() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return len(rc.entries)
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// maxEmbeddingInput keeps embedding requests within the model's input limit
+const maxEmbeddingInput = 8000
+
+// EmbeddingProvider turns text into a vector. Vectors from different
+// providers live in different spaces and must never be compared.
+type EmbeddingProvider interface {
+	Name() string
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// embeddingCharsPerToken estimates embedding token counts, which the API
+// doesn't report
+const embeddingCharsPerToken = 4
+
+// GeminiEmbedder computes embeddings with a Gemini embedding model. It has
+// its own circuit breaker so embedding outages don't stop judging.
+type GeminiEmbedder struct {
+	gc      *GeminiController
+	model   *genai.EmbeddingModel
+	breaker *CircuitBreaker
+}
+
+// NewGeminiEmbedder creates an embedder using the named Gemini embedding model
+func (gc *GeminiController) NewGeminiEmbedder(modelName string) *GeminiEmbedder {
+	model := gc.client.EmbeddingModel(modelName)
+	model.TaskType = genai.TaskTypeSemanticSimilarity
+	return &GeminiEmbedder{
+		gc:      gc,
+		model:   model,
+		breaker: NewCircuitBreaker(gc.config.BreakerThreshold, gc.config.BreakerCooldown),
+	}
+}
+
+func (e *GeminiEmbedder) Name() string {
+	return "gemini:" + e.model.Name()
+}
+
+// Embed embeds text, respecting the embedding circuit breaker and the
+// Gemini call timeout, and records the call's estimated usage
+func (e *GeminiEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	if !e.breaker.Allow() {
+		return nil, ErrAIUnavailable
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.gc.config.Timeout)
+	defer cancel()
+
+	input := truncateRunes(text, maxEmbeddingInput)
+	resp, err := e.model.EmbedContent(ctx, genai.Text(input))
+	if err != nil {
+		if isRetryable(err) {
+			e.breaker.RecordFailure()
+		} else {
+			e.breaker.Release()
+		}
+		return nil, err
+	}
+	e.breaker.RecordSuccess()
+
+	if e.gc.usage != nil {
+		tokens := int32(len(input)/embeddingCharsPerToken + 1)
+		e.gc.usage.Record(UsageRecord{
+			Endpoint:     "embedding",
+			Model:        e.model.Name(),
+			PromptTokens: tokens,
+			TotalTokens:  tokens,
+		})
+	}
+
+	if resp.Embedding == nil || len(resp.Embedding.Values) == 0 {
+		return nil, errors.New("empty embedding")
+	}
+	return resp.Embedding.Values, nil
+}
+
+// HashingEmbedder is a local, dependency-free fallback that hashes word
+// unigrams and bigrams into a fixed number of buckets
+type HashingEmbedder struct {
+	Dimensions int
+}
+
+// NewHashingEmbedder creates a hashing vectorizer with the given dimensions
+func NewHashingEmbedder(dimensions int) *HashingEmbedder {
+	return &HashingEmbedder{Dimensions: dimensions}
+}
+
+func (e *HashingEmbedder) Name() string {
+	return "hashing"
+}
+
+// Embed returns an L2-normalised, sublinear TF weighted feature vector
+func (e *HashingEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	tokens := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+
+	counts := make(map[int]float64)
+	add := func(feature string) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		index := int(sum % uint64(e.Dimensions))
+		// Use a separate bit for the sign so collisions tend to cancel out
+		if sum&(1<<63) != 0 {
+			counts[index]--
+		} else {
+			counts[index]++
+		}
+	}
+	for i, token := range tokens {
+		add(token)
+		if i > 0 {
+			add(tokens[i-1] + " " + token)
+		}
+	}
+
+	vector := make([]float32, e.Dimensions)
+	var norm float64
+	for index, count := range counts {
+		if count == 0 {
+			continue
+		}
+		weight := math.Copysign(1+math.Log(math.Abs(count)), count)
+		vector[index] = float32(weight)
+		norm += weight * weight
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range vector {
+			vector[i] = float32(float64(vector[i]) / norm)
+		}
+	}
+	return vector, nil
+}
+
+// CosineSimilarity returns the cosine of the angle between two vectors, or 0
+// if they have different lengths or either is all zeros
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+func truncateRunes(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max])
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MaxEnsembleSize caps how many judges a single ensemble request may ask
+const MaxEnsembleSize = 8
+
+// EnsembleMember is one persona/model pair asked to judge a post
+type EnsembleMember struct {
+	Persona string `json:"persona"`
+	Model   string `json:"model"`
+}
+
+// EnsembleVerdict is a single judge's answer
+type EnsembleVerdict struct {
+	Persona  string `json:"persona"`
+	Model    string `json:"model"`
+	Verdict  string `json:"verdict"`
+	Judgment string `json:"judgment"`
+	Error    string `json:"error,omitempty"`
+}
+
+// EnsembleResult combines every judge's verdict into a majority vote
+type EnsembleResult struct {
+	Verdicts  []EnsembleVerdict `json:"verdicts"`
+	Votes     map[string]int    `json:"votes"`
+	Majority  string            `json:"majority"`  // Empty when there is a tie or no valid votes
+	Agreement float64           `json:"agreement"` // Share of valid votes that went to the majority
+}
+
+// ValidateEnsemble rejects panels that are too big or ask the same judge
+// twice, which would count one persona's vote double
+func ValidateEnsemble(members []EnsembleMember) error {
+	if len(members) > MaxEnsembleSize {
+		return fmt.Errorf("an ensemble can have at most %d judges, got %d", MaxEnsembleSize, len(members))
+	}
+	seen := make(map[EnsembleMember]bool, len(members))
+	for _, member := range members {
+		if seen[member] {
+			return fmt.Errorf("judge %s on %s is listed more than once", member.Persona, member.Model)
+		}
+		seen[member] = true
+	}
+	return nil
+}
+
+// JudgeEnsemble asks every member to judge the post concurrently and tallies
+// their verdicts
+func (gc *GeminiController) JudgeEnsemble(call CallInfo, post string, members []EnsembleMember) (EnsembleResult, error) {
+	if err := ValidateEnsemble(members); err != nil {
+		return EnsembleResult{}, err
+	}
+
+	verdicts := make([]EnsembleVerdict, len(members))
+	var wg sync.WaitGroup
+	for i, member := range members {
+		wg.Add(1)
+		go func(i int, member EnsembleMember) {
+			defer wg.Done()
+
+			verdict := EnsembleVerdict{Persona: member.Persona, Model: member.Model}
+			persona, ok := Personas[member.Persona]
+			if !ok {
+				verdict.Error = "unknown persona"
+				verdicts[i] = verdict
+				return
+			}
+
+			response, err := gc.GenerateWithModel(call, member.Model, persona.Prompt(post))
+			if err != nil {
+				verdict.Error = err.Error()
+			} else {
+				verdict.Judgment = response
+				verdict.Verdict = ParseVerdict(response)
+			}
+			verdicts[i] = verdict
+		}(i, member)
+	}
+	wg.Wait()
+
+	return tallyVerdicts(verdicts), nil
+}
+
+// tallyVerdicts computes the majority verdict and how strongly judges agree
+func tallyVerdicts(verdicts []EnsembleVerdict) EnsembleResult {
+	result := EnsembleResult{
+		Verdicts: verdicts,
+		Votes:    make(map[string]int),
+	}
+
+	valid := 0
+	for _, v := range verdicts {
+		if v.Verdict != "" {
+			result.Votes[v.Verdict]++
+			valid++
+		}
+	}
+	if valid == 0 {
+		return result
+	}
+
+	best, tied := 0, false
+	for verdict, count := range result.Votes {
+		switch {
+		case count > best:
+			best, tied = count, false
+			result.Majority = verdict
+		case count == best:
+			tied = true
+		}
+	}
+	if tied {
+		result.Majority = ""
+	}
+	result.Agreement = float64(best) / float64(valid)
+
+	return result
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dwu006/aita/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxExcerptLength keeps quoted comments short enough for the prompt and UI
+const maxExcerptLength = 300
+
+// Explanation is a cached summary of why the community voted the way it did
+type Explanation struct {
+	PostID           string         `json:"post_id" bson:"post_id"`
+	UserVerdict      string         `json:"verdict" bson:"verdict"`
+	CommunityVerdict string         `json:"community_verdict" bson:"community_verdict"`
+	Agreed           bool           `json:"agreed" bson:"agreed"`
+	Summary          string         `json:"explanation" bson:"summary"`
+	Excerpts         []string       `json:"excerpts" bson:"excerpts"`
+	VoteCounts       map[string]int `json:"vote_counts" bson:"vote_counts"`
+	CreatedAt        time.Time      `json:"created_at" bson:"created_at"`
+}
+
+// ExplanationCache stores explanations per post and player verdict so each
+// combination only costs one model call
+type ExplanationCache struct {
+	collection *mongo.Collection
+	ttl        time.Duration
+}
+
+// NewExplanationCache creates an ExplanationCache backed by the explanations collection
+func NewExplanationCache(ttl time.Duration) *ExplanationCache {
+	ec := &ExplanationCache{
+		collection: db.GetDB().Collection("explanations"),
+		ttl:        ttl,
+	}
+
+	_, err := ec.collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "post_id", Value: 1}, {Key: "verdict", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		fmt.Println("Failed to create explanations index:", err)
+	}
+
+	return ec
+}
+
+// Get returns the cached explanation, or nil if there isn't a fresh one
+func (ec *ExplanationCache) Get(ctx context.Context, postID, verdict string) (*Explanation, error) {
+	var explanation Explanation
+	err := ec.collection.FindOne(ctx, bson.M{
+		"post_id":    postID,
+		"verdict":    verdict,
+		"created_at": bson.M{"$gte": time.Now().Add(-ec.ttl)},
+	}).Decode(&explanation)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &explanation, nil
+}
+
+// Put stores an explanation, replacing any older one for the same post and verdict
+func (ec *ExplanationCache) Put(ctx context.Context, explanation *Explanation) error {
+	_, err := ec.collection.ReplaceOne(ctx,
+		bson.M{"post_id": explanation.PostID, "verdict": explanation.UserVerdict},
+		explanation,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+// Excerpt trims a comment to a quotable length
+func Excerpt(comment string) string {
+	comment = strings.Join(strings.Fields(comment), " ")
+	if len(comment) <= maxExcerptLength {
+		return comment
+	}
+	cut := strings.LastIndex(comment[:maxExcerptLength], " ")
+	if cut <= 0 {
+		cut = maxExcerptLength
+	}
+	return comment[:cut] + "..."
+}
+
+// ExplainPrompt asks the model to summarise the strongest community arguments
+// for the winning verdict, quoting the supplied comment excerpts
+func ExplainPrompt(title, userVerdict, communityVerdict string, agreed bool, excerpts []string) string {
+	var b strings.Builder
+	if agreed {
+		fmt.Fprintf(&b, "A player judged the following AITA (Am I The Asshole) post as %s, and the Reddit community agreed with %s. ", userVerdict, communityVerdict)
+	} else {
+		fmt.Fprintf(&b, "A player judged the following AITA (Am I The Asshole) post as %s, but the Reddit community voted %s. ", userVerdict, communityVerdict)
+	}
+	fmt.Fprintf(&b, "Using ONLY the top-voted community comments below, summarise in 2-3 sentences the strongest arguments for %s, ", communityVerdict)
+	b.WriteString("and support each argument with a short direct quote from the comments in double quotes. Don't invent quotes and don't include any other text.\n\n")
+	fmt.Fprintf(&b, "Post title: %s\n\nTop comments:\n", title)
+	for i, excerpt := range excerpts {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, excerpt)
+	}
+	return b.String()
+}
@@ -2,16 +2,68 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
-	"google.golang.org/api/option"
 	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
 )
 
+// ErrAIUnavailable is returned when the circuit breaker is open and there is
+// no cached response to fall back on
+var ErrAIUnavailable = errors.New("AI unavailable")
+
+// ErrUnknownModel is returned when a call asks for a model that isn't configured
+var ErrUnknownModel = errors.New("unknown model")
+
+// GeminiConfig controls how calls to Gemini are made
+type GeminiConfig struct {
+	Model            string
+	EnsembleModels   []string      // Extra models that may be requested by name
+	Timeout          time.Duration // Deadline for a single call
+	MaxRetries       int           // Retries after the first attempt for retryable errors
+	BaseBackoff      time.Duration
+	MaxBackoff       time.Duration
+	BreakerThreshold int           // Consecutive failures before the breaker opens
+	BreakerCooldown  time.Duration // How long the breaker stays open
+	CacheSize        int
+	CacheTTL         time.Duration
+}
+
+// LoadGeminiConfig reads the Gemini call policy from the environment,
+// falling back to defaults for anything that is unset or invalid
+func LoadGeminiConfig() GeminiConfig {
+	return GeminiConfig{
+		Model:            envString("GEMINI_MODEL", "gemini-2.0-flash"),
+		EnsembleModels:   envList("GEMINI_ENSEMBLE_MODELS"),
+		Timeout:          envDuration("GEMINI_TIMEOUT", 15*time.Second),
+		MaxRetries:       envInt("GEMINI_MAX_RETRIES", 3),
+		BaseBackoff:      envDuration("GEMINI_BACKOFF", 500*time.Millisecond),
+		MaxBackoff:       envDuration("GEMINI_MAX_BACKOFF", 8*time.Second),
+		BreakerThreshold: envInt("GEMINI_BREAKER_THRESHOLD", 5),
+		BreakerCooldown:  envDuration("GEMINI_BREAKER_COOLDOWN", 30*time.Second),
+		CacheSize:        envInt("GEMINI_CACHE_SIZE", 500),
+		CacheTTL:         envDuration("GEMINI_CACHE_TTL", 24*time.Hour),
+	}
+}
+
 type GeminiController struct {
-	client *genai.Client
-	model  *genai.GenerativeModel
+	client  *genai.Client
+	model   *genai.GenerativeModel
+	models  map[string]*genai.GenerativeModel // Every callable model by name, including the default
+	config  GeminiConfig
+	breaker *CircuitBreaker
+	cache   *responseCache
+	usage   *UsageTracker
+	blocks  *BlockStats
 }
 
 func NewGeminiController() (*GeminiController, error) {
@@ -21,36 +73,234 @@ func NewGeminiController() (*GeminiController, error) {
 		return nil, err
 	}
 
-	model := client.GenerativeModel("gemini-2.0-flash")
+	config := LoadGeminiConfig()
+	safetySettings := LoadSafetySettings()
+
+	models := make(map[string]*genai.GenerativeModel)
+	for _, name := range append([]string{config.Model}, config.EnsembleModels...) {
+		model := client.GenerativeModel(name)
+		model.SafetySettings = safetySettings
+		models[name] = model
+	}
 
 	return &GeminiController{
-		client: client,
-		model:  model,
+		client:  client,
+		model:   models[config.Model],
+		models:  models,
+		config:  config,
+		breaker: NewCircuitBreaker(config.BreakerThreshold, config.BreakerCooldown),
+		cache:   newResponseCache(config.CacheSize, config.CacheTTL),
+		blocks:  newBlockStats(),
 	}, nil
 }
 
+// SetUsageTracker enables token usage recording for every call
+func (gc *GeminiController) SetUsageTracker(ut *UsageTracker) {
+	gc.usage = ut
+}
+
 func (gc *GeminiController) GenerateResponse(input string) (string, error) {
-	ctx := context.Background()
+	return gc.GenerateResponseFor(CallInfo{}, input)
+}
+
+// GenerateResponseFor generates a response and attributes its token usage to
+// the given user and endpoint
+func (gc *GeminiController) GenerateResponseFor(call CallInfo, input string) (string, error) {
+	return gc.GenerateWithModel(call, gc.config.Model, input)
+}
+
+// GenerateWithModel generates a response using one of the configured models
+func (gc *GeminiController) GenerateWithModel(call CallInfo, modelName string, input string) (string, error) {
+	model, ok := gc.models[modelName]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownModel, modelName)
+	}
 
 	// Dummy prompt for now, you can customize this later
 	prompt := "Given the following tasks, complete them: " + input
+	cacheKey := modelName + "\x00" + prompt
 
-	resp, err := gc.model.GenerateContent(ctx, genai.Text(prompt))
-	if err != nil {
-		return "", err
+	// Short-circuit while the breaker is open
+	if !gc.breaker.Allow() {
+		if cached, ok := gc.cache.Get(cacheKey); ok {
+			return cached, nil
+		}
+		return "", ErrAIUnavailable
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= gc.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(gc.backoff(attempt))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), gc.config.Timeout)
+		resp, err := model.GenerateContent(ctx, genai.Text(prompt))
+		cancel()
+
+		if err == nil {
+			gc.breaker.RecordSuccess()
+			text, err := checkResponse(resp)
+			gc.recordUsage(call, modelName, resp, err)
+			if err != nil {
+				return "", err
+			}
+			gc.cache.Set(cacheKey, text)
+			return text, nil
+		}
+
+		// A blocked prompt is a valid answer from a healthy upstream
+		if blocked, ok := asBlockedError(err); ok {
+			gc.breaker.RecordSuccess()
+			gc.recordUsage(call, modelName, nil, blocked)
+			return "", blocked
+		}
+
+		lastErr = err
+		if !isRetryable(err) {
+			// Bad requests say nothing about upstream health
+			gc.breaker.Release()
+			return "", err
+		}
+	}
+
+	gc.breaker.RecordFailure()
+
+	// Serve a stale answer rather than failing outright
+	if cached, ok := gc.cache.Get(cacheKey); ok {
+		return cached, nil
 	}
 
+	return "", fmt.Errorf("gemini call failed after %d attempts: %w", gc.config.MaxRetries+1, lastErr)
+}
+
+// recordUsage stores the token counts reported in the response metadata and
+// counts the call if it was blocked
+func (gc *GeminiController) recordUsage(call CallInfo, modelName string, resp *genai.GenerateContentResponse, callErr error) {
+	record := UsageRecord{
+		Username: call.Username,
+		Endpoint: call.Endpoint,
+		Model:    modelName,
+	}
+	if resp != nil && resp.UsageMetadata != nil {
+		record.PromptTokens = resp.UsageMetadata.PromptTokenCount
+		record.CandidatesTokens = resp.UsageMetadata.CandidatesTokenCount
+		record.TotalTokens = resp.UsageMetadata.TotalTokenCount
+	}
+
+	var blocked *BlockedError
+	if errors.As(callErr, &blocked) {
+		gc.blocks.record(call.Endpoint, blocked)
+		record.Blocked = blocked.Stage + ": " + blocked.Reason
+		fmt.Printf("Gemini %s blocked on %s: %s\n", blocked.Stage, call.Endpoint, blocked.Reason)
+	}
+
+	if gc.usage != nil {
+		gc.usage.Record(record)
+	}
+}
+
+// BlockStats reports how many calls have been blocked by the safety filter
+func (gc *GeminiController) BlockStats() BlockStatsSnapshot {
+	return gc.blocks.Snapshot()
+}
+
+// DefaultModel returns the name of the model used when none is requested
+func (gc *GeminiController) DefaultModel() string {
+	return gc.config.Model
+}
+
+// Models returns the names of every model that can be requested
+func (gc *GeminiController) Models() []string {
+	names := []string{gc.config.Model}
+	for _, name := range gc.config.EnsembleModels {
+		if name != gc.config.Model {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// BreakerStatus reports the circuit breaker state for health checks
+func (gc *GeminiController) BreakerStatus() BreakerStatus {
+	return gc.breaker.Status()
+}
+
+// CachedResponses returns how many responses are available as fallbacks
+func (gc *GeminiController) CachedResponses() int {
+	return gc.cache.Len()
+}
+
+func (gc *GeminiController) Close() {
+	gc.client.Close()
+}
+
+// backoff returns an exponential delay with full jitter for the given retry
+func (gc *GeminiController) backoff(attempt int) time.Duration {
+	delay := float64(gc.config.BaseBackoff) * math.Pow(2, float64(attempt-1))
+	if delay > float64(gc.config.MaxBackoff) {
+		delay = float64(gc.config.MaxBackoff)
+	}
+	return time.Duration(rand.Float64() * delay)
+}
+
+// responseText extracts the text of the first candidate
+func responseText(resp *genai.GenerateContentResponse) string {
 	// Assuming the response has at least one text part
-	if len(resp.Candidates) > 0 && len(resp.Candidates[0].Content.Parts) > 0 {
+	if resp != nil && len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil && len(resp.Candidates[0].Content.Parts) > 0 {
 		// Try to extract the text content
 		part := resp.Candidates[0].Content.Parts[0]
 		// Simply convert to string directly - the safest approach without knowing the exact type
-		return fmt.Sprintf("%v", part), nil
+		return fmt.Sprintf("%v", part)
+	}
+	return ""
+}
+
+// isRetryable reports whether err is a transient failure worth retrying:
+// rate limiting, server-side errors and per-call deadlines
+func isRetryable(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
 	}
 
-	return "", nil
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+	}
+	return false
 }
 
-func (gc *GeminiController) Close() {
-	gc.client.Close()
+func envString(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func envList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func envInt(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value >= 0 {
+		return value
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
 }
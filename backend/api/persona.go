@@ -0,0 +1,83 @@
+package api
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Persona is a voice the AI judge can answer in
+type Persona struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Description string `json:"description"`
+	Template    string `json:"-"` // %s is replaced with the post content
+}
+
+// DefaultPersona is used when a request doesn't ask for one
+const DefaultPersona = "redditor"
+
+// judgeFormat is appended to every persona so verdicts stay machine-readable
+const judgeFormat = "Format your response exactly like this: 'YTA' or 'NTA' followed by a period, then your A 1-2 sentence reason and explanation. Example: 'YTA. You should have communicated better.' or 'NTA. You were reasonable in this situation.'"
+
+// Personas are the available AI judge voices keyed by name
+var Personas = map[string]Persona{
+	"redditor": {
+		Name:        "redditor",
+		DisplayName: "Blunt Redditor",
+		Description: "A seasoned r/AmItheAsshole commenter who doesn't sugarcoat anything",
+		Template:    "Based on the following AITA (Am I The Asshole) post, determine if the poster is YTA (You're The Asshole) or NTA (Not The Asshole). " + judgeFormat + "\n\nPost content: %s",
+	},
+	"therapist": {
+		Name:        "therapist",
+		DisplayName: "Therapist",
+		Description: "A calm, empathetic therapist who looks at everyone's feelings",
+		Template:    "You are a warm, empathetic licensed therapist. Read the following AITA (Am I The Asshole) post and gently decide if the poster is YTA (You're The Asshole) or NTA (Not The Asshole), focusing on feelings, boundaries and communication. " + judgeFormat + "\n\nPost content: %s",
+	},
+	"lawyer": {
+		Name:        "lawyer",
+		DisplayName: "Lawyer",
+		Description: "A sharp attorney who weighs the facts and obligations of each party",
+		Template:    "You are a sharp, precise attorney. Review the following AITA (Am I The Asshole) post as if it were a case, weigh each party's obligations and the facts presented, and rule whether the poster is YTA (You're The Asshole) or NTA (Not The Asshole). " + judgeFormat + "\n\nPost content: %s",
+	},
+	"grandma": {
+		Name:        "grandma",
+		DisplayName: "Grandma",
+		Description: "A loving but old-fashioned grandmother with strong opinions on manners",
+		Template:    "You are a loving but old-fashioned grandmother with strong opinions about manners and family. Read the following AITA (Am I The Asshole) post and decide if the poster is YTA (You're The Asshole) or NTA (Not The Asshole), in your own homely voice. " + judgeFormat + "\n\nPost content: %s",
+	},
+}
+
+// PersonaNames returns the persona names in a stable order
+func PersonaNames() []string {
+	names := make([]string, 0, len(Personas))
+	for name := range Personas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Prompt fills the persona template with the post content
+func (p Persona) Prompt(post string) string {
+	return strings.Replace(p.Template, "%s", post, 1)
+}
+
+// verdictLinePattern matches the verdict the persona prompt asks the model to
+// open with, allowing for quotes or markdown around it. YTA, NTA and ESH match
+// in any case but NAH must be uppercase, since "nah" is an ordinary word.
+var verdictLinePattern = regexp.MustCompile(`^[\s"'*_>#-]*((?i:YTA|NTA|ESH)|NAH)\b`)
+
+// verdictPattern finds a verdict anywhere in the response when the model
+// didn't open with one. Only the uppercase acronyms count here.
+var verdictPattern = regexp.MustCompile(`\b(YTA|NTA|ESH|NAH)\b`)
+
+// ParseVerdict extracts the verdict (YTA, NTA, ESH or NAH) from a model
+// response, preferring the one it opens with, or returns an empty string if
+// there isn't one
+func ParseVerdict(response string) string {
+	if match := verdictLinePattern.FindStringSubmatch(response); match != nil {
+		return strings.ToUpper(match[1])
+	}
+	return verdictPattern.FindString(response)
+}
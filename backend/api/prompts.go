@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Categories are the post tags the model may choose from
+var Categories = []string{"Relationships", "Work", "Money", "Roommates", "Friends", "School", "Weddings", "Parenting", "In-Laws", "Public", "Revenge", "Neighbors"}
+
+// JudgeTemplates are versioned judge prompts that can be compared by the
+// evaluation command. %s is replaced with the post content.
+var JudgeTemplates = map[string]string{
+	// The original production prompt
+	"v1": Personas[DefaultPersona].Template,
+	// Lets the model use the full set of r/AmItheAsshole flairs
+	"v2": "Based on the following AITA (Am I The Asshole) post, give the verdict the r/AmItheAsshole community would most likely reach: YTA (You're The Asshole), NTA (Not The Asshole), ESH (Everyone Sucks Here) or NAH (No Assholes Here). Format your response exactly like this: the verdict followed by a period, then a 1-2 sentence reason. Example: 'ESH. You were rude, but so was your sister.'\n\nPost content: %s",
+}
+
+// JudgePrompt builds a judge prompt from a template version or persona name
+func JudgePrompt(name, post string) (string, bool) {
+	if template, ok := JudgeTemplates[name]; ok {
+		return strings.Replace(template, "%s", post, 1), true
+	}
+	if persona, ok := Personas[name]; ok {
+		return persona.Prompt(post), true
+	}
+	return "", false
+}
+
+// TLDRPrompt asks for a one sentence summary of a post
+func TLDRPrompt(content string) string {
+	return "Generate a ONE SENTENCE ONLY BRIEF AND CONCISE TLDR (Too Long; Didn't Read) summary of this post: " + content
+}
+
+// TagsPrompt asks for 1-2 category tags for a post as a JSON array
+func TagsPrompt(content string) string {
+	return "Given the following text, choose 1-2 relevant category tags from this list ONLY: [" + strings.Join(Categories, ", ") + "]. Format your response as a JSON array of strings, e.g. [\"Relationships\", \"Friends\"]. Don't include any other text in your response. Again only from the list. Here's the content: " + content
+}
+
+// DemographicsPrompt asks for the poster's age and gender and the people
+// involved in a post as JSON
+func DemographicsPrompt(title, body string) string {
+	return "Read the following AITA (Am I The Asshole) post and extract the poster's age and gender and the other people involved. Respond with JSON ONLY in exactly this shape: {\"poster\": {\"age\": 32, \"gender\": \"F\"}, \"people\": [{\"role\": \"husband\", \"age\": 35, \"gender\": \"M\"}]}. Gender must be \"M\", \"F\" or \"NB\". Describe each person's role relative to the poster in one or two words (e.g. \"sister\", \"coworker\", \"mother-in-law\"). Use 0 for an unknown age and \"\" for an unknown gender, and leave out poster if nothing is stated about them. Don't guess.\n\nTitle: " + title + "\n\nPost content: " + body
+}
+
+// ParseTags extracts the tags from a TagsPrompt response, dropping anything
+// that isn't a known category
+func ParseTags(response string) []string {
+	// Models sometimes wrap JSON in a markdown code fence
+	start := strings.Index(response, "[")
+	end := strings.LastIndex(response, "]")
+	if start < 0 || end < start {
+		return []string{}
+	}
+
+	var raw []string
+	if err := json.Unmarshal([]byte(response[start:end+1]), &raw); err != nil {
+		return []string{}
+	}
+
+	tags := []string{}
+	for _, tag := range raw {
+		for _, category := range Categories {
+			if strings.EqualFold(strings.TrimSpace(tag), category) && !containsTag(tags, category) {
+				tags = append(tags, category)
+			}
+		}
+	}
+	return tags
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
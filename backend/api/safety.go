@@ -0,0 +1,208 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Where a response was blocked
+const (
+	BlockedPrompt   = "prompt"
+	BlockedResponse = "response"
+)
+
+// ErrNoCandidates is returned when Gemini answers without any usable text
+var ErrNoCandidates = errors.New("model returned no candidates")
+
+// ErrUnexpectedFinish is returned when Gemini stops generating for a reason
+// other than finishing, running out of tokens or being filtered
+var ErrUnexpectedFinish = errors.New("model stopped unexpectedly")
+
+// blockFinishReasons are the finish reasons that mean the candidate was
+// filtered, with the names the API uses for them. The client library only
+// names the first two; the rest are the API's values for newer reasons.
+var blockFinishReasons = map[genai.FinishReason]string{
+	genai.FinishReasonSafety:     "SAFETY",
+	genai.FinishReasonRecitation: "RECITATION",
+	7:                            "BLOCKLIST",
+	8:                            "PROHIBITED_CONTENT",
+	9:                            "SPII",
+	11:                           "IMAGE_SAFETY",
+}
+
+// BlockedError is returned when Gemini refuses to answer, either because the
+// prompt itself was blocked or because the generated candidate was filtered
+type BlockedError struct {
+	Stage  string // BlockedPrompt or BlockedResponse
+	Reason string // BlockReason or FinishReason reported by the model
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("%s blocked by safety filter: %s", e.Stage, e.Reason)
+}
+
+// harmCategories are the categories the Gemini API accepts safety settings for
+var harmCategories = map[string]genai.HarmCategory{
+	"HARASSMENT":        genai.HarmCategoryHarassment,
+	"HATE_SPEECH":       genai.HarmCategoryHateSpeech,
+	"SEXUALLY_EXPLICIT": genai.HarmCategorySexuallyExplicit,
+	"DANGEROUS_CONTENT": genai.HarmCategoryDangerousContent,
+}
+
+var harmThresholds = map[string]genai.HarmBlockThreshold{
+	"BLOCK_NONE":             genai.HarmBlockNone,
+	"BLOCK_ONLY_HIGH":        genai.HarmBlockOnlyHigh,
+	"BLOCK_MEDIUM_AND_ABOVE": genai.HarmBlockMediumAndAbove,
+	"BLOCK_LOW_AND_ABOVE":    genai.HarmBlockLowAndAbove,
+}
+
+// LoadSafetySettings builds the model safety settings from the environment.
+// GEMINI_SAFETY_THRESHOLD sets the default for every category and
+// GEMINI_SAFETY_<CATEGORY> (e.g. GEMINI_SAFETY_HARASSMENT) overrides one.
+// AITA posts are full of interpersonal conflict, so the default only blocks
+// high-probability harm.
+func LoadSafetySettings() []*genai.SafetySetting {
+	defaultThreshold, ok := harmThresholds[strings.ToUpper(os.Getenv("GEMINI_SAFETY_THRESHOLD"))]
+	if !ok {
+		defaultThreshold = genai.HarmBlockOnlyHigh
+	}
+
+	settings := make([]*genai.SafetySetting, 0, len(harmCategories))
+	for name, category := range harmCategories {
+		threshold := defaultThreshold
+		if override, ok := harmThresholds[strings.ToUpper(os.Getenv("GEMINI_SAFETY_"+name))]; ok {
+			threshold = override
+		}
+		settings = append(settings, &genai.SafetySetting{Category: category, Threshold: threshold})
+	}
+	return settings
+}
+
+// checkResponse turns blocked or empty responses into typed errors
+func checkResponse(resp *genai.GenerateContentResponse) (string, error) {
+	if resp == nil || len(resp.Candidates) == 0 {
+		if resp != nil && resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != genai.BlockReasonUnspecified {
+			return "", &BlockedError{Stage: BlockedPrompt, Reason: resp.PromptFeedback.BlockReason.String()}
+		}
+		return "", ErrNoCandidates
+	}
+
+	candidate := resp.Candidates[0]
+	switch {
+	case blockFinishReasons[candidate.FinishReason] != "":
+		return "", &BlockedError{Stage: BlockedResponse, Reason: blockFinishReasons[candidate.FinishReason]}
+	case candidate.FinishReason > genai.FinishReasonMaxTokens:
+		return "", fmt.Errorf("%w: %s", ErrUnexpectedFinish, candidate.FinishReason)
+	}
+
+	text := responseText(resp)
+	if text == "" {
+		return "", ErrNoCandidates
+	}
+	return text, nil
+}
+
+// asBlockedError converts the client library's blocked error into ours
+func asBlockedError(err error) (*BlockedError, bool) {
+	var blocked *BlockedError
+	if errors.As(err, &blocked) {
+		return blocked, true
+	}
+
+	var genaiBlocked *genai.BlockedError
+	if !errors.As(err, &genaiBlocked) {
+		return nil, false
+	}
+	if genaiBlocked.PromptFeedback != nil {
+		return &BlockedError{Stage: BlockedPrompt, Reason: genaiBlocked.PromptFeedback.BlockReason.String()}, true
+	}
+	if genaiBlocked.Candidate != nil {
+		reason := blockFinishReasons[genaiBlocked.Candidate.FinishReason]
+		if reason == "" {
+			reason = genaiBlocked.Candidate.FinishReason.String()
+		}
+		return &BlockedError{Stage: BlockedResponse, Reason: reason}, true
+	}
+	return &BlockedError{Stage: BlockedResponse, Reason: "unknown"}, true
+}
+
+// ErrorStatus maps a Gemini call error to an HTTP status and a short code the
+// client can switch on
+func ErrorStatus(err error) (int, string) {
+	var blocked *BlockedError
+	switch {
+	case errors.As(err, &blocked) && blocked.Stage == BlockedPrompt:
+		return http.StatusUnprocessableEntity, "prompt_blocked"
+	case errors.As(err, &blocked):
+		return http.StatusUnprocessableEntity, "response_blocked"
+	case errors.Is(err, ErrNoCandidates):
+		return http.StatusBadGateway, "no_candidates"
+	case errors.Is(err, ErrUnexpectedFinish):
+		return http.StatusBadGateway, "unexpected_finish"
+	case errors.Is(err, ErrAIUnavailable):
+		return http.StatusServiceUnavailable, "ai_unavailable"
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, "ai_timeout"
+	default:
+		return http.StatusInternalServerError, "ai_error"
+	}
+}
+
+// BlockStats counts blocked calls since startup
+type BlockStats struct {
+	mu         sync.Mutex
+	total      int64
+	byStage    map[string]int64
+	byEndpoint map[string]int64
+}
+
+// BlockStatsSnapshot is the JSON view of BlockStats
+type BlockStatsSnapshot struct {
+	Total      int64            `json:"total"`
+	ByStage    map[string]int64 `json:"by_stage"`
+	ByEndpoint map[string]int64 `json:"by_endpoint"`
+}
+
+func newBlockStats() *BlockStats {
+	return &BlockStats{
+		byStage:    make(map[string]int64),
+		byEndpoint: make(map[string]int64),
+	}
+}
+
+func (bs *BlockStats) record(endpoint string, blocked *BlockedError) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	bs.total++
+	bs.byStage[blocked.Stage]++
+	if endpoint != "" {
+		bs.byEndpoint[endpoint]++
+	}
+}
+
+// Snapshot returns a copy of the current counters
+func (bs *BlockStats) Snapshot() BlockStatsSnapshot {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	snapshot := BlockStatsSnapshot{
+		Total:      bs.total,
+		ByStage:    make(map[string]int64, len(bs.byStage)),
+		ByEndpoint: make(map[string]int64, len(bs.byEndpoint)),
+	}
+	for k, v := range bs.byStage {
+		snapshot.ByStage[k] = v
+	}
+	for k, v := range bs.byEndpoint {
+		snapshot.ByEndpoint[k] = v
+	}
+	return snapshot
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dwu006/aita/db"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CallInfo identifies who made a Gemini call and from which endpoint
+type CallInfo struct {
+	Endpoint string
+	Username string
+}
+
+// UsageRecord is a single Gemini call stored in the llm_usage collection
+type UsageRecord struct {
+	Username         string    `json:"username" bson:"username"`
+	Endpoint         string    `json:"endpoint" bson:"endpoint"`
+	Model            string    `json:"model" bson:"model"`
+	PromptTokens     int32     `json:"prompt_tokens" bson:"prompt_tokens"`
+	CandidatesTokens int32     `json:"candidates_tokens" bson:"candidates_tokens"`
+	TotalTokens      int32     `json:"total_tokens" bson:"total_tokens"`
+	EstimatedCost    float64   `json:"estimated_cost" bson:"estimated_cost"`       // USD
+	Blocked          string    `json:"blocked,omitempty" bson:"blocked,omitempty"` // Safety block stage and reason
+	CreatedAt        time.Time `json:"created_at" bson:"created_at"`
+}
+
+// UsageSummary aggregates usage for one group of calls
+type UsageSummary struct {
+	Key              string  `json:"key" bson:"_id"`
+	Calls            int     `json:"calls" bson:"calls"`
+	Blocked          int     `json:"blocked" bson:"blocked"`
+	PromptTokens     int64   `json:"prompt_tokens" bson:"prompt_tokens"`
+	CandidatesTokens int64   `json:"candidates_tokens" bson:"candidates_tokens"`
+	TotalTokens      int64   `json:"total_tokens" bson:"total_tokens"`
+	EstimatedCost    float64 `json:"estimated_cost" bson:"estimated_cost"`
+}
+
+// modelPrice is the USD price per million tokens for a model
+type modelPrice struct {
+	Input  float64
+	Output float64
+}
+
+// Published per-million-token prices, used for cost estimates only
+var modelPrices = map[string]modelPrice{
+	"gemini-2.0-flash":      {Input: 0.10, Output: 0.40},
+	"gemini-2.0-flash-lite": {Input: 0.075, Output: 0.30},
+	"gemini-1.5-flash":      {Input: 0.075, Output: 0.30},
+	"gemini-1.5-pro":        {Input: 1.25, Output: 5.00},
+}
+
+// EstimateCost returns the estimated USD cost of a call, or 0 for unknown models
+func EstimateCost(model string, promptTokens, candidatesTokens int32) float64 {
+	price, ok := modelPrices[strings.TrimPrefix(model, "models/")]
+	if !ok {
+		return 0
+	}
+	return (float64(promptTokens)*price.Input + float64(candidatesTokens)*price.Output) / 1e6
+}
+
+// UsageTracker records Gemini token usage and enforces per-user daily quotas
+type UsageTracker struct {
+	collection *mongo.Collection
+	dailyQuota int64 // Tokens per user per UTC day, 0 disables the quota
+}
+
+// NewUsageTracker creates a UsageTracker backed by the llm_usage collection
+func NewUsageTracker(dailyQuota int64) *UsageTracker {
+	ut := &UsageTracker{
+		collection: db.GetDB().Collection("llm_usage"),
+		dailyQuota: dailyQuota,
+	}
+
+	// Quota checks and summaries filter by user and time
+	_, err := ut.collection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "username", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		fmt.Println("Failed to create llm_usage indexes:", err)
+	}
+
+	return ut
+}
+
+// Record stores a usage record, logging rather than failing on errors
+func (ut *UsageTracker) Record(record UsageRecord) {
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	record.EstimatedCost = EstimateCost(record.Model, record.PromptTokens, record.CandidatesTokens)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := ut.collection.InsertOne(ctx, record); err != nil {
+		fmt.Println("Failed to record LLM usage:", err)
+	}
+}
+
+// TokensUsedToday returns the tokens a user has consumed since UTC midnight
+func (ut *UsageTracker) TokensUsedToday(ctx context.Context, username string) (int64, error) {
+	startOfDay := time.Now().UTC().Truncate(24 * time.Hour)
+
+	cursor, err := ut.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"username": username, "created_at": bson.M{"$gte": startOfDay}}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "total": bson.M{"$sum": "$total_tokens"}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Total int64 `bson:"total"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return 0, err
+	}
+	if len(result) == 0 {
+		return 0, nil
+	}
+	return result[0].Total, nil
+}
+
+// QuotaMiddleware rejects requests from users who have used up their daily
+// token quota. It must run after AuthMiddleware.
+func (ut *UsageTracker) QuotaMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ut.dailyQuota <= 0 {
+			c.Next()
+			return
+		}
+
+		username := c.GetString("username")
+		if username == "" {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		used, err := ut.TokensUsedToday(ctx, username)
+		if err != nil {
+			// Don't block players because the usage store is down
+			fmt.Println("Failed to check LLM quota:", err)
+			c.Next()
+			return
+		}
+
+		if used >= ut.dailyQuota {
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":     "Daily AI quota exceeded",
+				"quota":     ut.dailyQuota,
+				"used":      used,
+				"resets_at": time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour),
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Summary aggregates usage between from and to, grouped by "username",
+// "endpoint" or "model"
+func (ut *UsageTracker) Summary(ctx context.Context, from, to time.Time, groupBy string) ([]UsageSummary, error) {
+	cursor, err := ut.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"created_at": bson.M{"$gte": from, "$lt": to}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":               "$" + groupBy,
+			"calls":             bson.M{"$sum": 1},
+			"blocked":           bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$ifNull": bson.A{"$blocked", false}}, 1, 0}}},
+			"prompt_tokens":     bson.M{"$sum": "$prompt_tokens"},
+			"candidates_tokens": bson.M{"$sum": "$candidates_tokens"},
+			"total_tokens":      bson.M{"$sum": "$total_tokens"},
+			"estimated_cost":    bson.M{"$sum": "$estimated_cost"},
+		}}},
+		{{Key: "$sort", Value: bson.M{"total_tokens": -1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	summaries := []UsageSummary{}
+	if err := cursor.All(ctx, &summaries); err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
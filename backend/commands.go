@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dwu006/aita/api"
+	"github.com/dwu006/aita/controller"
+	"github.com/dwu006/aita/evaluation"
+	"github.com/dwu006/aita/jobs"
+)
+
+// runCommand runs one of the offline maintenance commands
+func runCommand(name string, args []string) error {
+	// Stop cleanly on Ctrl-C so jobs can keep their checkpoint
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch name {
+	case "archive-leaderboards":
+		return runArchiveLeaderboards(ctx)
+	case "enrich":
+		return runEnrich(ctx, args)
+	case "eval":
+		return runEval(ctx, args)
+	case "migrate-history":
+		return runMigrateHistory(ctx)
+	case "rebuild-activity":
+		return runRebuildActivity(ctx)
+	case "recalc-xp":
+		return runRecalcXP(ctx)
+	case "recount-verdicts":
+		return runRecountVerdicts(ctx)
+	case "refresh-difficulty":
+		return runRefreshDifficulty(ctx)
+	default:
+		return fmt.Errorf("unknown command %q (available: archive-leaderboards, enrich, eval, migrate-history, rebuild-activity, recalc-xp, recount-verdicts, refresh-difficulty)", name)
+	}
+}
+
+// runArchiveLeaderboards records the winners of every finished leaderboard
+// period. The server does this in the background; run it to catch up a long
+// backlog before starting the server.
+func runArchiveLeaderboards(ctx context.Context) error {
+	uc := controller.NewUserController(os.Getenv("JWT_SECRET"), nil)
+	archived, err := uc.ArchiveLeaderboards(ctx)
+	fmt.Printf("Archived %d leaderboard periods\n", archived)
+	return err
+}
+
+// runRecountVerdicts recounts every catalogued post's comment verdicts and
+// rescores the judgments on posts whose community verdict changed. Run it
+// after changing how comments are classified.
+func runRecountVerdicts(ctx context.Context) error {
+	uc := controller.NewUserController(os.Getenv("JWT_SECRET"), nil)
+	changed, err := uc.RecountVerdicts(ctx)
+	fmt.Printf("Changed the community verdict of %d posts\n", changed)
+	return err
+}
+
+// runRefreshDifficulty rerates every catalogued post from its comment
+// verdicts and player answers
+func runRefreshDifficulty(ctx context.Context) error {
+	refreshed, err := controller.NewPostCatalog().RefreshDifficulty(ctx)
+	fmt.Printf("Refreshed difficulty for %d posts\n", refreshed)
+	return err
+}
+
+// runRecalcXP recalculates every user's XP and level from their judgments.
+// Judgments keep the difficulty they were made at, so run it after changing
+// the XP rules to bring stored XP in line.
+func runRecalcXP(ctx context.Context) error {
+	uc := controller.NewUserController(os.Getenv("JWT_SECRET"), nil)
+	recalculated, err := uc.RecalculateXP(ctx)
+	fmt.Printf("Recalculated XP for %d users\n", recalculated)
+	return err
+}
+
+// runRebuildActivity recreates the per-day activity log from judgments
+func runRebuildActivity(ctx context.Context) error {
+	uc := controller.NewUserController(os.Getenv("JWT_SECRET"), nil)
+	rebuilt, err := uc.RebuildActivity(ctx)
+	fmt.Printf("Rebuilt activity for %d users\n", rebuilt)
+	return err
+}
+
+// runMigrateHistory copies legacy post_history maps into the judgments collection
+func runMigrateHistory(ctx context.Context) error {
+	uc := controller.NewUserController(os.Getenv("JWT_SECRET"), nil)
+	migrated, err := uc.MigratePostHistory(ctx)
+	fmt.Printf("Migrated %d judgments\n", migrated)
+	return err
+}
+
+// runEnrich backfills TLDR, tags and AI judgments on stored posts
+func runEnrich(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("enrich", flag.ExitOnError)
+	since := flags.String("since", "", "only enrich posts created on or after this date (YYYY-MM-DD)")
+	subreddit := flags.String("subreddit", "", "only enrich posts from this subreddit")
+	concurrency := flags.Int("concurrency", 4, "number of posts to enrich in parallel")
+	rate := flags.Float64("rate", 2, "maximum Gemini calls per second")
+	force := flags.Bool("force", false, "regenerate fields that are already set")
+	restart := flags.Bool("restart", false, "ignore the saved checkpoint and start from the beginning")
+	flags.Parse(args)
+
+	opts := jobs.EnrichOptions{
+		Subreddit:     *subreddit,
+		Concurrency:   *concurrency,
+		RatePerSecond: *rate,
+		Force:         *force,
+		Restart:       *restart,
+	}
+	if *since != "" {
+		parsed, err := time.Parse("2006-01-02", *since)
+		if err != nil {
+			return fmt.Errorf("invalid --since date: %w", err)
+		}
+		opts.Since = parsed
+	}
+
+	gc, err := api.NewGeminiController()
+	if err != nil {
+		return err
+	}
+	defer gc.Close()
+	gc.SetUsageTracker(newUsageTracker())
+
+	return jobs.RunEnrich(ctx, gc, opts)
+}
+
+// runEval measures how often judge variants agree with Reddit's final verdict
+// on a labelled dataset
+func runEval(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("eval", flag.ExitOnError)
+	dataset := flags.String("dataset", "fixtures/eval_sample.jsonl", "JSONL file of labelled posts")
+	templates := flags.String("templates", "v1", "comma separated judge template versions or persona names")
+	models := flags.String("models", "", "comma separated models to compare (default: the configured model)")
+	concurrency := flags.Int("concurrency", 4, "number of posts judged in parallel")
+	rate := flags.Float64("rate", 2, "maximum Gemini calls per second")
+	collapse := flags.Bool("collapse", true, "score YTA/NTA only, folding ESH into YTA and NAH into NTA")
+	limit := flags.Int("limit", 0, "only evaluate the first N examples")
+	out := flags.String("out", "", "also write the full reports and predictions as JSON to this file")
+	flags.Parse(args)
+
+	examples, err := evaluation.LoadDataset(*dataset)
+	if err != nil {
+		return fmt.Errorf("failed to load dataset: %w", err)
+	}
+	if *limit > 0 && *limit < len(examples) {
+		examples = examples[:*limit]
+	}
+
+	gc, err := api.NewGeminiController()
+	if err != nil {
+		return err
+	}
+	defer gc.Close()
+	gc.SetUsageTracker(newUsageTracker())
+
+	modelNames := splitList(*models)
+	if len(modelNames) == 0 {
+		modelNames = []string{gc.DefaultModel()}
+	}
+
+	var variants []evaluation.Variant
+	for _, template := range splitList(*templates) {
+		if _, ok := api.JudgePrompt(template, ""); !ok {
+			return fmt.Errorf("unknown template %q", template)
+		}
+		for _, model := range modelNames {
+			variants = append(variants, evaluation.Variant{Template: template, Model: model})
+		}
+	}
+
+	type variantResult struct {
+		Report      evaluation.Report       `json:"report"`
+		Predictions []evaluation.Prediction `json:"predictions"`
+	}
+	var results []variantResult
+	var reports []evaluation.Report
+	for _, variant := range variants {
+		fmt.Printf("Evaluating %s on %d examples...\n", variant.Name(), len(examples))
+		predictions := evaluation.Run(ctx, gc, examples, variant, evaluation.RunOptions{
+			Concurrency:   *concurrency,
+			RatePerSecond: *rate,
+			Collapse:      *collapse,
+		})
+		report := evaluation.Evaluate(variant.Name(), predictions)
+		reports = append(reports, report)
+		results = append(results, variantResult{Report: report, Predictions: predictions})
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	fmt.Println()
+	fmt.Print(evaluation.FormatComparison(reports))
+
+	if *out != "" {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*out, data, 0644); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		fmt.Println("\nWrote report to", *out)
+	}
+
+	return ctx.Err()
+}
+
+// splitList splits a comma separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
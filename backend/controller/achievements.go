@@ -0,0 +1,288 @@
+package controller
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/dwu006/aita/api"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Achievement metrics
+const (
+	MetricJudgments      = "judgments"       // Posts judged
+	MetricStreak         = "streak"          // Longest streak in days
+	MetricAccuracy       = "accuracy"        // Accuracy percentage, once min_sample posts are scored
+	MetricContrarianWins = "contrarian_wins" // Posts got right when most other players got them wrong
+	MetricCategories     = "categories"      // Distinct categories judged; no threshold means all of them
+)
+
+// ContrarianMinPlayers is how many other players must have judged a post
+// before a correct minority answer counts as a contrarian win
+const ContrarianMinPlayers = 5
+
+// Achievement is a badge definition loaded from achievements.json
+type Achievement struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Icon        string  `json:"icon"`
+	Metric      string  `json:"metric"`
+	Threshold   float64 `json:"threshold"`
+	MinSample   int     `json:"min_sample,omitempty"`
+}
+
+// AchievementMetrics are the user stats achievements are measured against
+type AchievementMetrics struct {
+	Judgments      int
+	Streak         int
+	Accuracy       float64
+	Scored         int
+	ContrarianWins int
+	Categories     int
+}
+
+// AchievementProgress is an achievement with how close a user is to it
+type AchievementProgress struct {
+	Achievement
+	Current  float64    `json:"current"`
+	Progress float64    `json:"progress"` // 0 to 1
+	Earned   bool       `json:"earned"`
+	EarnedAt *time.Time `json:"earned_at,omitempty"`
+}
+
+// EarnedAchievement records that a user unlocked an achievement
+type EarnedAchievement struct {
+	Username      string    `bson:"username"`
+	AchievementID string    `bson:"achievement_id"`
+	EarnedAt      time.Time `bson:"earned_at"`
+}
+
+//go:embed achievements.json
+var achievementsJSON []byte
+
+// Achievements are the available achievements, in display order
+var Achievements = loadAchievements()
+
+func loadAchievements() []Achievement {
+	var achievements []Achievement
+	if err := json.Unmarshal(achievementsJSON, &achievements); err != nil {
+		panic(fmt.Sprintf("invalid achievements.json: %v", err))
+	}
+	for i := range achievements {
+		if achievements[i].Metric == MetricCategories && achievements[i].Threshold == 0 {
+			achievements[i].Threshold = float64(len(api.Categories))
+		}
+	}
+	return achievements
+}
+
+// Measure returns the user's current value for the achievement's metric and
+// whether it has been reached
+func (a Achievement) Measure(metrics AchievementMetrics) (float64, bool) {
+	var current float64
+	switch a.Metric {
+	case MetricJudgments:
+		current = float64(metrics.Judgments)
+	case MetricStreak:
+		current = float64(metrics.Streak)
+	case MetricAccuracy:
+		// Accuracy doesn't count until there are enough scored posts
+		if metrics.Scored < a.MinSample {
+			return 0, false
+		}
+		current = metrics.Accuracy
+	case MetricContrarianWins:
+		current = float64(metrics.ContrarianWins)
+	case MetricCategories:
+		current = float64(metrics.Categories)
+	default:
+		return 0, false
+	}
+	return current, current >= a.Threshold
+}
+
+// progress returns how far along the achievement the user is, from 0 to 1
+func (a Achievement) progress(metrics AchievementMetrics, current float64) float64 {
+	if a.Metric == MetricAccuracy && a.MinSample > 0 && metrics.Scored < a.MinSample {
+		// Show progress towards the sample size first
+		return float64(metrics.Scored) / float64(a.MinSample) / 2
+	}
+	if a.Threshold <= 0 {
+		return 1
+	}
+	return math.Min(current/a.Threshold, 1)
+}
+
+// metrics collects the stats achievements are measured against
+func (u *User) metrics() AchievementMetrics {
+	streak := u.LongestStreak
+	if u.StreakCount > streak {
+		streak = u.StreakCount
+	}
+	return AchievementMetrics{
+		Judgments:      u.NumPosts,
+		Streak:         streak,
+		Accuracy:       u.Accuracy,
+		Scored:         u.ScoredJudgments,
+		ContrarianWins: u.ContrarianWins,
+		Categories:     len(u.CategoryStats),
+	}
+}
+
+// createAchievementIndexes makes awarding idempotent
+func (uc *UserController) createAchievementIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := uc.achievements.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "username", Value: 1}, {Key: "achievement_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		fmt.Println("Failed to create achievements index:", err)
+	}
+}
+
+// awardAchievements awards every achievement the user has reached and
+// returns the ones they didn't already have
+func (uc *UserController) awardAchievements(ctx context.Context, user *User) ([]Achievement, error) {
+	metrics := user.metrics()
+	earned := []Achievement{}
+	for _, achievement := range Achievements {
+		if _, done := achievement.Measure(metrics); !done {
+			continue
+		}
+
+		// Upserting on the unique index means each achievement is only awarded once
+		result, err := uc.achievements.UpdateOne(ctx,
+			bson.M{"username": user.Username, "achievement_id": achievement.ID},
+			bson.M{"$setOnInsert": EarnedAchievement{Username: user.Username, AchievementID: achievement.ID, EarnedAt: uc.now()}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return earned, err
+		}
+		if result.UpsertedCount > 0 {
+			earned = append(earned, achievement)
+		}
+	}
+	return earned, nil
+}
+
+// isContrarianWin reports whether a correct judgment went against most of
+// the other players who judged the post
+func (uc *UserController) isContrarianWin(ctx context.Context, judgment *Judgment) (bool, error) {
+	if judgment.Correct == nil || !*judgment.Correct {
+		return false, nil
+	}
+
+	others, err := uc.judgments.CountDocuments(ctx, bson.M{
+		"post_id":   judgment.PostID,
+		"username":  bson.M{"$ne": judgment.Username},
+		"undone_at": bson.M{"$exists": false},
+	})
+	if err != nil || others < ContrarianMinPlayers {
+		return false, err
+	}
+
+	agreeing, err := uc.judgments.CountDocuments(ctx, bson.M{
+		"post_id":        judgment.PostID,
+		"username":       bson.M{"$ne": judgment.Username},
+		"undone_at":      bson.M{"$exists": false},
+		"scored_verdict": judgment.ScoredVerdict,
+	})
+	if err != nil {
+		return false, err
+	}
+	return agreeing*2 < others, nil
+}
+
+// onJudgment runs the achievement checks for a newly recorded judgment and
+// returns any achievements it unlocked
+func (uc *UserController) onJudgment(ctx context.Context, user *User, judgment *Judgment) ([]Achievement, error) {
+	contrarian, err := uc.isContrarianWin(ctx, judgment)
+	if err != nil {
+		return nil, err
+	}
+	if contrarian {
+		// Marking the judgment lets an undo take the win back
+		judgment.ContrarianWin = true
+		if _, err := uc.judgments.UpdateOne(ctx, bson.M{"_id": judgment.ID}, bson.M{"$set": bson.M{"contrarian_win": true}}); err != nil {
+			return nil, err
+		}
+		user.ContrarianWins++
+		_, err := uc.collection.UpdateOne(ctx, bson.M{"username": user.Username}, bson.M{"$inc": bson.M{"contrarian_wins": 1}})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return uc.awardAchievements(ctx, user)
+}
+
+// GetAchievements lists every achievement with the user's progress, split
+// into earned and still available
+func (uc *UserController) GetAchievements(c *gin.Context) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user User
+	if err := uc.collection.FindOne(ctx, bson.M{"username": username}).Decode(&user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find user"})
+		return
+	}
+
+	cursor, err := uc.achievements.Find(ctx, bson.M{"username": username})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch achievements", "details": err.Error()})
+		return
+	}
+	var records []EarnedAchievement
+	if err := cursor.All(ctx, &records); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch achievements", "details": err.Error()})
+		return
+	}
+	earnedAt := make(map[string]time.Time, len(records))
+	for _, record := range records {
+		earnedAt[record.AchievementID] = record.EarnedAt
+	}
+
+	metrics := user.metrics()
+	earned := []AchievementProgress{}
+	available := []AchievementProgress{}
+	for _, achievement := range Achievements {
+		current, _ := achievement.Measure(metrics)
+		progress := AchievementProgress{
+			Achievement: achievement,
+			Current:     current,
+			Progress:    achievement.progress(metrics, current),
+		}
+		if at, ok := earnedAt[achievement.ID]; ok {
+			progress.Earned = true
+			progress.EarnedAt = &at
+			progress.Progress = 1
+			earned = append(earned, progress)
+		} else {
+			available = append(available, progress)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"earned":    earned,
+		"available": available,
+	})
+}
@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ActivityDay counts the judgments a user made on one day in their timezone
+type ActivityDay struct {
+	Username  string    `json:"-" bson:"username"`
+	Day       string    `json:"day" bson:"day"` // YYYY-MM-DD
+	Count     int       `json:"count" bson:"count"`
+	UpdatedAt time.Time `json:"-" bson:"updated_at"`
+}
+
+// activityDay returns the activity log key for the day containing t in loc
+func activityDay(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("2006-01-02")
+}
+
+// createActivityIndexes sets up the activity log indexes
+func (uc *UserController) createActivityIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := uc.activity.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "username", Value: 1}, {Key: "day", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		fmt.Println("Failed to create activity index:", err)
+	}
+}
+
+// recordActivity counts a judgment made at t and reports whether it was the
+// user's first that day
+func (uc *UserController) recordActivity(ctx context.Context, username string, t time.Time, loc *time.Location) (bool, error) {
+	result, err := uc.activity.UpdateOne(ctx,
+		bson.M{"username": username, "day": activityDay(t, loc)},
+		bson.M{"$inc": bson.M{"count": 1}, "$set": bson.M{"updated_at": uc.now()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.UpsertedCount > 0, nil
+}
+
+// undoActivity takes back an undone judgment made at t. If it was the only
+// one that day, the day is dropped from the log, the total active days and
+// the streak.
+func (uc *UserController) undoActivity(ctx context.Context, username string, t time.Time) error {
+	var user User
+	if err := uc.collection.FindOne(ctx, bson.M{"username": username}).Decode(&user); err != nil {
+		return err
+	}
+	loc := LoadLocation(user.Timezone)
+	day := activityDay(t, loc)
+
+	var updated ActivityDay
+	err := uc.activity.FindOneAndUpdate(ctx,
+		bson.M{"username": username, "day": day},
+		bson.M{"$inc": bson.M{"count": -1}, "$set": bson.M{"updated_at": uc.now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil || updated.Count > 0 {
+		return err
+	}
+
+	if _, err := uc.activity.DeleteOne(ctx, bson.M{"username": username, "day": day}); err != nil {
+		return err
+	}
+
+	user.setStreak(RemoveStreakDay(user.streak(), t, loc))
+	_, err = uc.collection.UpdateOne(ctx, bson.M{"username": username}, bson.M{
+		"$set": bson.M{
+			"streak_dates":        user.StreakDates,
+			"streak_count":        user.StreakCount,
+			"longest_streak":      user.LongestStreak,
+			"streak_freezes":      user.StreakFreezes,
+			"frozen_dates":        user.FrozenDates,
+			"prev_longest_streak": user.PrevLongest,
+			"earned_freeze":       user.EarnedFreeze,
+		},
+		"$inc": bson.M{"total_active_days": -1},
+	})
+	return err
+}
+
+// GetActivity returns the number of judgments the user made on each day of a
+// year (defaulting to the current one), for a contribution-style calendar
+func (uc *UserController) GetActivity(c *gin.Context) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var user User
+	if err := uc.collection.FindOne(ctx, bson.M{"username": username}).Decode(&user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find user"})
+		return
+	}
+	loc := LoadLocation(user.Timezone)
+
+	year := uc.now().In(loc).Year()
+	if value := c.Query("year"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 2000 || parsed > 9999 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "year must be a four digit year"})
+			return
+		}
+		year = parsed
+	}
+
+	// Day keys sort lexically, so a string range selects the year
+	cursor, err := uc.activity.Find(ctx, bson.M{
+		"username": username,
+		"day":      bson.M{"$gte": fmt.Sprintf("%04d-01-01", year), "$lte": fmt.Sprintf("%04d-12-31", year)},
+		"count":    bson.M{"$gt": 0},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch activity", "details": err.Error()})
+		return
+	}
+	var days []ActivityDay
+	if err := cursor.All(ctx, &days); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch activity", "details": err.Error()})
+		return
+	}
+
+	counts := make(map[string]int, len(days))
+	judgments := 0
+	for _, day := range days {
+		counts[day.Day] = day.Count
+		judgments += day.Count
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"year":              year,
+		"timezone":          loc.String(),
+		"days":              counts,
+		"active_days":       len(days),
+		"judgments":         judgments,
+		"total_active_days": user.TotalActiveDays,
+		"current_streak":    CurrentStreak(user.streak(), uc.now(), loc),
+		"longest_streak":    user.LongestStreak,
+	})
+}
+
+// RebuildActivity recreates every user's activity log and total active days
+// from their judgments. Migrated judgments are skipped because their real
+// dates weren't recorded.
+func (uc *UserController) RebuildActivity(ctx context.Context) (int, error) {
+	cursor, err := uc.collection.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"username": 1, "timezone": 1, "streak_count": 1, "longest_streak": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	rebuilt := 0
+	for cursor.Next(ctx) {
+		var user User
+		if err := cursor.Decode(&user); err != nil {
+			return rebuilt, err
+		}
+		loc := LoadLocation(user.Timezone)
+
+		judgments, err := uc.judgments.Find(ctx,
+			bson.M{"username": user.Username, "undone_at": bson.M{"$exists": false}, "source": bson.M{"$ne": SourceMigration}},
+			options.Find().SetProjection(bson.M{"created_at": 1}),
+		)
+		if err != nil {
+			return rebuilt, err
+		}
+		counts := make(map[string]int)
+		for judgments.Next(ctx) {
+			var judgment Judgment
+			if err := judgments.Decode(&judgment); err != nil {
+				judgments.Close(ctx)
+				return rebuilt, err
+			}
+			counts[activityDay(judgment.CreatedAt, loc)]++
+		}
+		judgments.Close(ctx)
+
+		if _, err := uc.activity.DeleteMany(ctx, bson.M{"username": user.Username}); err != nil {
+			return rebuilt, err
+		}
+		for day, count := range counts {
+			_, err := uc.activity.InsertOne(ctx, ActivityDay{Username: user.Username, Day: day, Count: count, UpdatedAt: uc.now()})
+			if err != nil {
+				return rebuilt, err
+			}
+		}
+
+		longest := user.LongestStreak
+		if user.StreakCount > longest {
+			longest = user.StreakCount
+		}
+		_, err = uc.collection.UpdateOne(ctx, bson.M{"username": user.Username}, bson.M{"$set": bson.M{
+			"total_active_days": len(counts),
+			"longest_streak":    longest,
+		}})
+		if err != nil {
+			return rebuilt, err
+		}
+		rebuilt++
+	}
+	return rebuilt, cursor.Err()
+}
@@ -0,0 +1,390 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dwu006/aita/api"
+	"github.com/dwu006/aita/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DuplicateThreshold is the cosine similarity above which two posts are
+// treated as the same story reposted
+const DuplicateThreshold = 0.95
+
+// PostEmbedding is a post's vector from one embedding provider
+type PostEmbedding struct {
+	PostID    string    `bson:"post_id"`
+	Provider  string    `bson:"provider"`
+	Vector    []float32 `bson:"vector"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// SimilarPost is a nearest neighbour returned by Similar
+type SimilarPost struct {
+	PostID           string  `json:"id"`
+	Title            string  `json:"title"`
+	Subreddit        string  `json:"subreddit"`
+	CommunityVerdict string  `json:"community_verdict,omitempty"`
+	Similarity       float64 `json:"similarity"`
+	NearDuplicate    bool    `json:"near_duplicate"`
+}
+
+// PostCatalog stores posts fetched from Reddit along with their embeddings
+type PostCatalog struct {
+	posts      *mongo.Collection
+	embeddings *mongo.Collection
+	judgments  *mongo.Collection       // Player answers, for post difficulty
+	providers  []api.EmbeddingProvider // In order of preference
+
+	demographicsFallback DemographicsFallback
+	vectorIndexes        map[string]string // Atlas vector search index for each provider, if any
+}
+
+// NewPostCatalog creates a PostCatalog that embeds posts with every provider
+// given, preferring earlier ones for similarity search
+func NewPostCatalog(providers ...api.EmbeddingProvider) *PostCatalog {
+	pc := &PostCatalog{
+		posts:      db.GetDB().Collection("posts"),
+		embeddings: db.GetDB().Collection("post_embeddings"),
+		judgments:  db.GetDB().Collection("judgments"),
+		providers:  providers,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := pc.posts.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "post_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		fmt.Println("Failed to create posts index:", err)
+	}
+
+	// Feed filters
+	_, err = pc.posts.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "demographics.poster.gender", Value: 1}, {Key: "demographics.poster.age", Value: 1}}},
+		{Keys: bson.D{{Key: "demographics.people.role", Value: 1}}},
+		{Keys: bson.D{{Key: "difficulty.score", Value: 1}}},
+	})
+	if err != nil {
+		fmt.Println("Failed to create posts demographics indexes:", err)
+	}
+
+	_, err = pc.embeddings.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "provider", Value: 1}, {Key: "post_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		// Newest vectors first, for searches without a vector index
+		{Keys: bson.D{{Key: "provider", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		fmt.Println("Failed to create post_embeddings index:", err)
+	}
+
+	return pc
+}
+
+// SetDemographicsFallback sets how to extract demographics from posts the
+// regex parser can't read the poster's age or gender from
+func (pc *PostCatalog) SetDemographicsFallback(fallback DemographicsFallback) {
+	pc.demographicsFallback = fallback
+}
+
+// FindPost returns a catalogued post, or mongo.ErrNoDocuments if it hasn't been stored
+func (pc *PostCatalog) FindPost(ctx context.Context, postID string) (*Post, error) {
+	var post Post
+	if err := pc.posts.FindOne(ctx, bson.M{"post_id": postID}).Decode(&post); err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// PostFilter narrows the catalogue feed. Zero values don't filter.
+type PostFilter struct {
+	Subreddit     string
+	PosterGender  string
+	MinAge        int
+	MaxAge        int
+	Relationship  string  // Someone in the post, e.g. "mother-in-law"
+	MinDifficulty float64 // Difficulty scores, from 0 to 1
+	MaxDifficulty float64
+	Sort          string // SortNewest (default), SortHardest or SortEasiest
+	Limit         int
+	Offset        int
+}
+
+// ListPosts returns catalogued posts matching the filter, leaving out
+// reposts
+func (pc *PostCatalog) ListPosts(ctx context.Context, filter PostFilter) ([]Post, error) {
+	query := bson.M{"duplicate_of": bson.M{"$exists": false}}
+	if filter.Subreddit != "" {
+		query["subreddit"] = filter.Subreddit
+	}
+	if filter.PosterGender != "" {
+		query["demographics.poster.gender"] = strings.ToUpper(filter.PosterGender)
+	}
+	if filter.MinAge > 0 || filter.MaxAge > 0 {
+		age := bson.M{}
+		if filter.MinAge > 0 {
+			age["$gte"] = filter.MinAge
+		}
+		if filter.MaxAge > 0 {
+			age["$lte"] = filter.MaxAge
+		}
+		query["demographics.poster.age"] = age
+	}
+	if filter.Relationship != "" {
+		role := strings.ToLower(filter.Relationship)
+		if canonical, ok := relationshipAliases[role]; ok {
+			role = canonical
+		}
+		query["demographics.people.role"] = role
+	}
+	if filter.MinDifficulty > 0 || filter.MaxDifficulty > 0 {
+		difficulty := bson.M{}
+		if filter.MinDifficulty > 0 {
+			difficulty["$gte"] = filter.MinDifficulty
+		}
+		if filter.MaxDifficulty > 0 {
+			difficulty["$lte"] = filter.MaxDifficulty
+		}
+		query["difficulty.score"] = difficulty
+	}
+
+	order := bson.D{{Key: "catalogued_at", Value: -1}}
+	switch filter.Sort {
+	case SortHardest:
+		order = bson.D{{Key: "difficulty.score", Value: -1}, {Key: "catalogued_at", Value: -1}}
+	case SortEasiest:
+		order = bson.D{{Key: "difficulty.score", Value: 1}, {Key: "catalogued_at", Value: -1}}
+	}
+
+	opts := options.Find().
+		SetSort(order).
+		SetSkip(int64(filter.Offset)).
+		SetLimit(int64(filter.Limit)).
+		SetProjection(bson.M{"comments": 0})
+	cursor, err := pc.posts.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	posts := []Post{}
+	if err := cursor.All(ctx, &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// SetTags stores category tags on a catalogued post. It reports whether the
+// post was in the catalogue.
+func (pc *PostCatalog) SetTags(ctx context.Context, postID string, tags []string) (bool, error) {
+	result, err := pc.posts.UpdateOne(ctx, bson.M{"post_id": postID}, bson.M{"$set": bson.M{"tags": tags}})
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// Ingest stores posts, records the community verdict from their comments when
+// they were fetched, embeds any that haven't been embedded yet and flags
+// near-duplicates of stories already in the catalogue
+func (pc *PostCatalog) Ingest(ctx context.Context, posts []Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	for _, post := range posts {
+		set := bson.M{
+			"title":        post.Title,
+			"url":          post.URL,
+			"score":        post.Score,
+			"created_utc":  post.CreatedUTC,
+			"author":       post.Author,
+			"num_comments": post.NumComments,
+			"selftext":     post.SelfText,
+			"is_self":      post.IsSelf,
+			"subreddit":    post.Subreddit,
+			"demographics": pc.extractDemographics(ctx, post),
+		}
+		// Comments are missing when fetching them failed, which mustn't wipe
+		// the verdict already recorded for the post
+		if len(post.Comments) > 0 {
+			counts := CountVerdicts(post.Comments)
+			set["comments"] = post.Comments
+			set["verdict_counts"] = counts
+			set["community_verdict"] = CommunityVerdict(counts)
+		}
+		update := bson.M{
+			"$set":         set,
+			"$setOnInsert": bson.M{"catalogued_at": time.Now()},
+		}
+		_, err := pc.posts.UpdateOne(ctx, bson.M{"post_id": post.PostID}, update, options.Update().SetUpsert(true))
+		if err != nil {
+			return fmt.Errorf("failed to store post %s: %w", post.PostID, err)
+		}
+		if err := refreshDifficulty(ctx, pc.posts, pc.judgments, post.PostID); err != nil {
+			fmt.Printf("Failed to rate difficulty of post %s: %v\n", post.PostID, err)
+		}
+
+		duplicateChecked := false
+		for _, provider := range pc.providers {
+			embedded, err := pc.embeddings.CountDocuments(ctx, bson.M{"provider": provider.Name(), "post_id": post.PostID})
+			if err != nil {
+				return fmt.Errorf("failed to check embeddings: %w", err)
+			}
+			if embedded > 0 {
+				continue
+			}
+
+			vector, err := provider.Embed(ctx, post.Title+"\n\n"+post.SelfText)
+			if err != nil {
+				// Later providers act as the fallback
+				fmt.Printf("Failed to embed post %s with %s: %v\n", post.PostID, provider.Name(), err)
+				continue
+			}
+
+			_, err = pc.embeddings.UpdateOne(ctx,
+				bson.M{"provider": provider.Name(), "post_id": post.PostID},
+				bson.M{"$set": PostEmbedding{PostID: post.PostID, Provider: provider.Name(), Vector: vector, CreatedAt: time.Now()}},
+				options.Update().SetUpsert(true),
+			)
+			if err != nil {
+				fmt.Printf("Failed to store embedding for post %s: %v\n", post.PostID, err)
+				continue
+			}
+
+			// Use the best available provider to look for reposts
+			if !duplicateChecked {
+				duplicateChecked = true
+				closest, err := pc.nearestPosts(ctx, provider.Name(), vector, post.PostID, 1)
+				if err != nil {
+					fmt.Printf("Failed to look for reposts of post %s: %v\n", post.PostID, err)
+				} else if len(closest) == 1 && closest[0].similarity >= DuplicateThreshold {
+					original, similarity := closest[0].postID, closest[0].similarity
+					fmt.Printf("Post %s looks like a repost of %s (similarity %.3f)\n", post.PostID, original, similarity)
+					_, err = pc.posts.UpdateOne(ctx, bson.M{"post_id": post.PostID}, bson.M{"$set": bson.M{"duplicate_of": original}})
+					if err != nil {
+						fmt.Printf("Failed to flag duplicate post %s: %v\n", post.PostID, err)
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// extractDemographics parses the people in a post, asking the fallback only
+// when the regex parser found nothing about the poster
+func (pc *PostCatalog) extractDemographics(ctx context.Context, post Post) *Demographics {
+	demographics := ExtractDemographics(post.Title, post.SelfText)
+	if demographics.Poster != nil || pc.demographicsFallback == nil {
+		return &demographics
+	}
+
+	// Don't pay for the fallback again when the post is re-fetched
+	var existing Post
+	err := pc.posts.FindOne(ctx, bson.M{"post_id": post.PostID, "demographics.source": "llm"}).Decode(&existing)
+	if err == nil && existing.Demographics != nil {
+		return existing.Demographics
+	}
+
+	inferred, err := pc.demographicsFallback(post.Title, post.SelfText)
+	if err != nil {
+		fmt.Printf("Failed to infer demographics for post %s: %v\n", post.PostID, err)
+		return &demographics
+	}
+
+	// Keep anyone the regex parser found that the fallback missed
+	for _, person := range demographics.People {
+		found := false
+		for _, other := range inferred.People {
+			if other.Role == person.Role {
+				found = true
+				break
+			}
+		}
+		if !found {
+			inferred.People = append(inferred.People, person)
+		}
+	}
+	return inferred
+}
+
+// Similar returns the catalogued posts closest to postID by cosine similarity
+func (pc *PostCatalog) Similar(ctx context.Context, postID string, limit int) ([]SimilarPost, error) {
+	for _, provider := range pc.providers {
+		var query PostEmbedding
+		err := pc.embeddings.FindOne(ctx, bson.M{"provider": provider.Name(), "post_id": postID}).Decode(&query)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		candidates, err := pc.nearestPosts(ctx, provider.Name(), query.Vector, postID, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		ids := make([]string, len(candidates))
+		for i, candidate := range candidates {
+			ids[i] = candidate.postID
+		}
+		postsByID, err := pc.findPosts(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+
+		results := make([]SimilarPost, 0, len(candidates))
+		for _, candidate := range candidates {
+			post, ok := postsByID[candidate.postID]
+			if !ok {
+				continue
+			}
+			results = append(results, SimilarPost{
+				PostID:           post.PostID,
+				Title:            post.Title,
+				Subreddit:        post.Subreddit,
+				CommunityVerdict: post.CommunityVerdict,
+				Similarity:       candidate.similarity,
+				NearDuplicate:    candidate.similarity >= DuplicateThreshold,
+			})
+		}
+		return results, nil
+	}
+
+	return nil, fmt.Errorf("post %s has no embeddings", postID)
+}
+
+// findPosts loads catalogued posts by ID
+func (pc *PostCatalog) findPosts(ctx context.Context, ids []string) (map[string]Post, error) {
+	cursor, err := pc.posts.Find(ctx, bson.M{"post_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var posts []Post
+	if err := cursor.All(ctx, &posts); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]Post, len(posts))
+	for _, post := range posts {
+		byID[post.PostID] = post
+	}
+	return byID, nil
+}
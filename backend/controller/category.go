@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"math"
+	"sort"
+)
+
+// CategoryStats is how a user does on posts tagged with one category
+type CategoryStats struct {
+	Judged   int     `json:"judged" bson:"judged"`
+	Scored   int     `json:"scored" bson:"scored"` // Judged posts with a community verdict
+	Correct  int     `json:"correct" bson:"correct"`
+	Accuracy float64 `json:"accuracy" bson:"accuracy"` // Percentage of scored posts judged correctly
+}
+
+// ComputeCategoryStats tallies judgments per category. tags and verdicts are
+// keyed by post ID; posts without tags don't count towards any category and
+// posts without a community verdict count as judged but not scored.
+func ComputeCategoryStats(history map[string]string, tags map[string][]string, verdicts map[string]string) map[string]CategoryStats {
+	stats := make(map[string]CategoryStats)
+	for postID, judgment := range history {
+		side := VerdictSide(verdicts[postID])
+		for _, tag := range tags[postID] {
+			category := stats[tag]
+			category.Judged++
+			if side != "" {
+				category.Scored++
+				if side == judgment {
+					category.Correct++
+				}
+			}
+			stats[tag] = category
+		}
+	}
+
+	for tag, category := range stats {
+		category.Accuracy = category.accuracy()
+		stats[tag] = category
+	}
+	return stats
+}
+
+// accuracy is the percentage of scored posts judged correctly, to one
+// decimal place
+func (c CategoryStats) accuracy() float64 {
+	if c.Scored == 0 {
+		return 0
+	}
+	return math.Round(float64(c.Correct)/float64(c.Scored)*1000) / 10
+}
+
+// FavouriteCategory returns the category judged most often, breaking ties
+// by accuracy and then alphabetically
+func FavouriteCategory(stats map[string]CategoryStats) string {
+	categories := make([]string, 0, len(stats))
+	for tag := range stats {
+		categories = append(categories, tag)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		a, b := stats[categories[i]], stats[categories[j]]
+		if a.Judged != b.Judged {
+			return a.Judged > b.Judged
+		}
+		if a.Accuracy != b.Accuracy {
+			return a.Accuracy > b.Accuracy
+		}
+		return categories[i] < categories[j]
+	})
+
+	if len(categories) == 0 {
+		return ""
+	}
+	return categories[0]
+}
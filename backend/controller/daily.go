@@ -0,0 +1,469 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DailyChallengeSize is how many posts are in each day's challenge
+const DailyChallengeSize = 5
+
+// ErrNoDailyPosts means the catalogue doesn't have enough scored posts for a challenge
+var ErrNoDailyPosts = errors.New("not enough catalogued posts for a daily challenge")
+
+// DailyChallenge is the set of posts every player gets on one UTC calendar
+// day. Using the same day everywhere means a challenge post's verdict only
+// has to be withheld for one 24 hour window.
+type DailyChallenge struct {
+	Date      string    `json:"date" bson:"date"` // YYYY-MM-DD
+	PostIDs   []string  `json:"post_ids" bson:"post_ids"`
+	CreatedAt time.Time `json:"-" bson:"created_at"`
+}
+
+// DailyAnswer is a player's verdict on one challenge post
+type DailyAnswer struct {
+	PostID           string `json:"post_id" bson:"post_id"`
+	Verdict          string `json:"verdict" bson:"verdict"`
+	CommunityVerdict string `json:"community_verdict" bson:"community_verdict"`
+	Correct          bool   `json:"correct" bson:"correct"`
+}
+
+// DailyAttempt is a player's one go at a day's challenge
+type DailyAttempt struct {
+	Username    string        `json:"username" bson:"username"`
+	Date        string        `json:"date" bson:"date"`
+	Answers     []DailyAnswer `json:"answers,omitempty" bson:"answers"`
+	Score       int           `json:"score" bson:"score"`
+	CompletedAt time.Time     `json:"completed_at" bson:"completed_at"`
+}
+
+// SelectDailyPosts picks n posts for date from the candidate IDs. The same
+// candidates and date always give the same posts in the same order.
+func SelectDailyPosts(candidates []string, date string, n int) []string {
+	ids := append([]string(nil), candidates...)
+	sort.Strings(ids)
+
+	seed := fnv.New64a()
+	seed.Write([]byte("aita-daily:" + date))
+	rng := rand.New(rand.NewSource(int64(seed.Sum64())))
+	rng.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+
+	if len(ids) > n {
+		ids = ids[:n]
+	}
+	return ids
+}
+
+// ShareText returns an attempt's result as text to paste anywhere, one
+// square per post in challenge order
+func ShareText(attempt DailyAttempt) string {
+	var grid strings.Builder
+	for _, answer := range attempt.Answers {
+		if answer.Correct {
+			grid.WriteString("🟩")
+		} else {
+			grid.WriteString("🟥")
+		}
+	}
+	return fmt.Sprintf("AITA Daily %s %d/%d\n%s", attempt.Date, attempt.Score, len(attempt.Answers), grid.String())
+}
+
+// createDailyIndexes allows one challenge per day and one attempt per player per day
+func (uc *UserController) createDailyIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := uc.dailyChallenges.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "date", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		fmt.Println("Failed to create daily challenge index:", err)
+	}
+
+	_, err = uc.dailyAttempts.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "username", Value: 1}, {Key: "date", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "date", Value: 1}, {Key: "score", Value: -1}, {Key: "completed_at", Value: 1}},
+		},
+	})
+	if err != nil {
+		fmt.Println("Failed to create daily attempt indexes:", err)
+	}
+}
+
+// dailyChallenge returns the challenge for date, choosing its posts the first
+// time anyone asks. The chosen set is stored so it can't shift as posts are
+// added to the catalogue during the day.
+func (uc *UserController) dailyChallenge(ctx context.Context, date string) (*DailyChallenge, error) {
+	var challenge DailyChallenge
+	err := uc.dailyChallenges.FindOne(ctx, bson.M{"date": date}).Decode(&challenge)
+	if err == nil {
+		return &challenge, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	candidates, err := uc.scorablePostIDs(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) < DailyChallengeSize {
+		return nil, ErrNoDailyPosts
+	}
+
+	challenge = DailyChallenge{
+		Date:      date,
+		PostIDs:   SelectDailyPosts(candidates, date, DailyChallengeSize),
+		CreatedAt: uc.now(),
+	}
+	// If another request stored the day's set first, use theirs
+	_, err = uc.dailyChallenges.UpdateOne(ctx,
+		bson.M{"date": date},
+		bson.M{"$setOnInsert": challenge},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+	if err := uc.dailyChallenges.FindOne(ctx, bson.M{"date": date}).Decode(&challenge); err != nil {
+		return nil, err
+	}
+	return &challenge, nil
+}
+
+// scorablePostIDs returns the catalogued posts with a clear community
+// verdict, which are the only ones that can be scored, leaving out exclude
+func (uc *UserController) scorablePostIDs(ctx context.Context, exclude []string) ([]string, error) {
+	filter := bson.M{
+		"duplicate_of":      bson.M{"$exists": false},
+		"community_verdict": bson.M{"$in": []string{VerdictYTA, VerdictNTA, VerdictESH, VerdictNAH}},
+	}
+	if len(exclude) > 0 {
+		filter["post_id"] = bson.M{"$nin": exclude}
+	}
+	cursor, err := uc.posts.Find(ctx, filter, options.Find().SetProjection(bson.M{"post_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var posts []Post
+	if err := cursor.All(ctx, &posts); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.PostID
+	}
+	return ids, nil
+}
+
+// challengePosts loads a challenge's posts in challenge order
+func (uc *UserController) challengePosts(ctx context.Context, challenge *DailyChallenge) ([]Post, error) {
+	return uc.orderedPosts(ctx, challenge.PostIDs)
+}
+
+// orderedPosts loads posts without their comments, in the order given
+func (uc *UserController) orderedPosts(ctx context.Context, ids []string) ([]Post, error) {
+	cursor, err := uc.posts.Find(ctx,
+		bson.M{"post_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"comments": 0}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var found []Post
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	byID := make(map[string]Post, len(found))
+	for _, post := range found {
+		byID[post.PostID] = post
+	}
+
+	posts := make([]Post, 0, len(ids))
+	for _, id := range ids {
+		if post, ok := byID[id]; ok {
+			posts = append(posts, post)
+		}
+	}
+	return posts, nil
+}
+
+// challengeDay returns the date of the current challenge
+func (uc *UserController) challengeDay() string {
+	return activityDay(uc.now(), time.UTC)
+}
+
+// challengeEnds returns when the challenge for date is over
+func challengeEnds(date string) time.Time {
+	day, _ := time.Parse("2006-01-02", date)
+	return day.AddDate(0, 0, 1)
+}
+
+// hideVerdicts blanks out everything that would give away the answers
+func hideVerdicts(posts []Post) {
+	for i := range posts {
+		posts[i].Comments = nil
+		posts[i].VerdictCounts = nil
+		posts[i].CommunityVerdict = ""
+		posts[i].AIJudgment = ""
+		posts[i].AIVerdict = ""
+	}
+}
+
+// WithheldPosts returns the IDs of posts that are in play, whose verdicts
+// mustn't be given away anywhere else until the game is over. That is the
+// current daily challenge and any duel still being played.
+func (uc *UserController) WithheldPosts(ctx context.Context) (map[string]bool, error) {
+	withheld := map[string]bool{}
+	var challenge DailyChallenge
+	err := uc.dailyChallenges.FindOne(ctx, bson.M{"date": uc.challengeDay()}).Decode(&challenge)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	for _, id := range challenge.PostIDs {
+		withheld[id] = true
+	}
+
+	duelled, err := uc.duelPostIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range duelled {
+		withheld[id] = true
+	}
+	return withheld, nil
+}
+
+// WithholdVerdicts hides the answers on any of the posts that are in play
+func (uc *UserController) WithholdVerdicts(ctx context.Context, posts []Post) error {
+	withheld, err := uc.WithheldPosts(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		if withheld[posts[i].PostID] {
+			hideVerdicts(posts[i : i+1])
+		}
+	}
+	return nil
+}
+
+// withholdJudgments hides the answers on judgments of posts that are in play
+func (uc *UserController) withholdJudgments(ctx context.Context, judgments []Judgment) error {
+	withheld, err := uc.WithheldPosts(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range judgments {
+		if withheld[judgments[i].PostID] {
+			judgments[i] = judgments[i].hideAnswer()
+		}
+	}
+	return nil
+}
+
+// GetDailyChallenge returns the current challenge's posts. Community
+// verdicts are hidden until the user has made their attempt.
+func (uc *UserController) GetDailyChallenge(c *gin.Context) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	date := uc.challengeDay()
+	challenge, err := uc.dailyChallenge(ctx, date)
+	if errors.Is(err, ErrNoDailyPosts) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "No daily challenge available yet"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load daily challenge", "details": err.Error()})
+		return
+	}
+	posts, err := uc.challengePosts(ctx, challenge)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load daily challenge", "details": err.Error()})
+		return
+	}
+
+	var attempt DailyAttempt
+	err = uc.dailyAttempts.FindOne(ctx, bson.M{"username": username, "date": date}).Decode(&attempt)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load attempt", "details": err.Error()})
+		return
+	}
+	completed := err == nil
+
+	if !completed {
+		hideVerdicts(posts)
+	}
+
+	response := gin.H{
+		"date":      date,
+		"ends_at":   challengeEnds(date),
+		"posts":     posts,
+		"completed": completed,
+	}
+	if completed {
+		response["attempt"] = attempt
+		response["share_text"] = ShareText(attempt)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// scoreAnswers checks a map of post_id to YTA or NTA against the posts'
+// community verdicts. Every post needs an answer.
+func scoreAnswers(posts []Post, verdicts map[string]string) ([]DailyAnswer, int, error) {
+	answers := make([]DailyAnswer, 0, len(posts))
+	score := 0
+	for _, post := range posts {
+		verdict := verdicts[post.PostID]
+		if verdict != VerdictYTA && verdict != VerdictNTA {
+			return nil, 0, fmt.Errorf("post %s needs a YTA or NTA answer", post.PostID)
+		}
+		answer := DailyAnswer{
+			PostID:           post.PostID,
+			Verdict:          verdict,
+			CommunityVerdict: post.CommunityVerdict,
+			Correct:          VerdictSide(post.CommunityVerdict) == verdict,
+		}
+		if answer.Correct {
+			score++
+		}
+		answers = append(answers, answer)
+	}
+	return answers, score, nil
+}
+
+// SubmitDailyChallenge scores the user's answers to the current challenge.
+// Each player gets one attempt.
+func (uc *UserController) SubmitDailyChallenge(c *gin.Context) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		Date    string            `json:"date" binding:"required"`    // The challenge date the answers are for
+		Answers map[string]string `json:"answers" binding:"required"` // Map of post_id to YTA or NTA
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	date := uc.challengeDay()
+	if req.Date != date {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "That challenge has ended", "date": date})
+		return
+	}
+
+	challenge, err := uc.dailyChallenge(ctx, date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load daily challenge", "details": err.Error()})
+		return
+	}
+	posts, err := uc.challengePosts(ctx, challenge)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load daily challenge", "details": err.Error()})
+		return
+	}
+
+	attempt := DailyAttempt{Username: username, Date: date, CompletedAt: uc.now()}
+	attempt.Answers, attempt.Score, err = scoreAnswers(posts, req.Answers)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The unique index enforces one attempt per day
+	if _, err := uc.dailyAttempts.InsertOne(ctx, attempt); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "You have already played today's challenge"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attempt", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"attempt":    attempt,
+		"share_text": ShareText(attempt),
+	})
+}
+
+// GetDailyLeaderboard ranks a day's attempts by score, then by who finished
+// first. It defaults to the current challenge.
+func (uc *UserController) GetDailyLeaderboard(c *gin.Context) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	date := c.Query("date")
+	if date == "" {
+		date = uc.challengeDay()
+	} else if _, err := time.Parse("2006-01-02", date); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date, expected YYYY-MM-DD"})
+		return
+	}
+
+	cursor, err := uc.dailyAttempts.Find(ctx,
+		bson.M{"date": date},
+		options.Find().
+			SetSort(bson.D{{Key: "score", Value: -1}, {Key: "completed_at", Value: 1}}).
+			SetLimit(50).
+			SetProjection(bson.M{"username": 1, "date": 1, "score": 1, "completed_at": 1}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve attempts", "details": err.Error()})
+		return
+	}
+	attempts := []DailyAttempt{}
+	if err := cursor.All(ctx, &attempts); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode attempts", "details": err.Error()})
+		return
+	}
+
+	players, err := uc.dailyAttempts.CountDocuments(ctx, bson.M{"date": date})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count attempts", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"date":     date,
+		"size":     DailyChallengeSize,
+		"players":  players,
+		"rankings": attempts,
+	})
+}
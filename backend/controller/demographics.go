@@ -0,0 +1,308 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Person is someone mentioned in a post, described relative to the poster
+type Person struct {
+	Role   string `json:"role" bson:"role"`                         // "poster", "husband", "sister", ...
+	Age    int    `json:"age,omitempty" bson:"age,omitempty"`       // 0 when unknown
+	Gender string `json:"gender,omitempty" bson:"gender,omitempty"` // "M", "F" or "NB"
+}
+
+// Demographics are the structured facts extracted from a post
+type Demographics struct {
+	Poster *Person  `json:"poster,omitempty" bson:"poster,omitempty"`
+	People []Person `json:"people,omitempty" bson:"people,omitempty"`
+	Source string   `json:"source" bson:"source"` // "regex" or "llm"
+}
+
+// DemographicsFallback extracts demographics some other way (e.g. with an
+// LLM) when the regex parser finds nothing about the poster
+type DemographicsFallback func(title, body string) (*Demographics, error)
+
+// Age/gender markers such as (32F), [M35], (25 nb) or a bare 32F. Bare
+// markers must be upper case so "waited 30m" isn't read as a 30 year old.
+var (
+	ageGenderPattern = regexp.MustCompile(`(?i:[\(\[]\s*(\d{1,2})\s*(nb|m|f)\s*[\)\]]|[\(\[]\s*(nb|m|f)\s*(\d{1,2})\s*[\)\]])|\b(\d{1,2})([MF])\b`)
+	wordPattern      = regexp.MustCompile(`[A-Za-z'-]+`)
+	myRolePattern    = regexp.MustCompile(`(?i)\bmy\s+(?:(?:ex|step|future|older|younger|little|big|best|soon-to-be)[\s-]+)?([a-z'-]+)`)
+)
+
+// posterWords are the words that introduce the poster themselves
+var posterWords = map[string]bool{"i": true, "me": true, "my": true, "myself": true, "i'm": true, "im": true, "mine": true}
+
+// relationshipAliases maps the words posters use to a canonical role
+var relationshipAliases = map[string]string{
+	"husband": "husband", "hubby": "husband", "wife": "wife",
+	"boyfriend": "boyfriend", "bf": "boyfriend", "girlfriend": "girlfriend", "gf": "girlfriend",
+	"partner": "partner", "fiance": "fiance", "fiancé": "fiance", "fiancee": "fiance", "fiancée": "fiance", "ex": "ex",
+	"mom": "mother", "mum": "mother", "mother": "mother", "dad": "father", "father": "father", "parents": "parents",
+	"son": "son", "daughter": "daughter", "kid": "child", "child": "child", "baby": "child", "kids": "children", "children": "children",
+	"brother": "brother", "sister": "sister", "sibling": "sibling", "twin": "sibling",
+	"stepmom": "stepmother", "stepmother": "stepmother", "stepdad": "stepfather", "stepfather": "stepfather",
+	"stepson": "stepson", "stepdaughter": "stepdaughter", "stepsister": "stepsister", "stepbrother": "stepbrother",
+	"grandma": "grandmother", "grandmother": "grandmother", "grandpa": "grandfather", "grandfather": "grandfather",
+	"aunt": "aunt", "uncle": "uncle", "cousin": "cousin", "niece": "niece", "nephew": "nephew",
+	"mil": "mother-in-law", "mother-in-law": "mother-in-law", "fil": "father-in-law", "father-in-law": "father-in-law",
+	"sil": "sister-in-law", "sister-in-law": "sister-in-law", "bil": "brother-in-law", "brother-in-law": "brother-in-law",
+	"friend": "friend", "bff": "friend", "roommate": "roommate", "flatmate": "roommate",
+	"coworker": "coworker", "co-worker": "coworker", "colleague": "coworker", "boss": "boss", "manager": "boss",
+	"neighbor": "neighbor", "neighbour": "neighbor", "landlord": "landlord", "tenant": "tenant",
+	"teacher": "teacher", "classmate": "classmate", "date": "date",
+}
+
+// ExtractDemographics parses the poster's age and gender and the people
+// involved from a post's title and body
+func ExtractDemographics(title, body string) Demographics {
+	demographics := Demographics{Source: "regex"}
+	seen := make(map[string]int) // role -> index in People
+
+	addPerson := func(person Person) {
+		if person.Role == "poster" {
+			if demographics.Poster == nil {
+				demographics.Poster = &Person{Role: "poster", Age: person.Age, Gender: person.Gender}
+			}
+			return
+		}
+		if i, ok := seen[person.Role]; ok {
+			// Fill in details from a later, more specific mention
+			if demographics.People[i].Age == 0 {
+				demographics.People[i].Age = person.Age
+			}
+			if demographics.People[i].Gender == "" {
+				demographics.People[i].Gender = person.Gender
+			}
+			return
+		}
+		seen[person.Role] = len(demographics.People)
+		demographics.People = append(demographics.People, person)
+	}
+
+	for _, text := range []string{title, body} {
+		// People with an age/gender marker
+		for _, match := range ageGenderPattern.FindAllStringSubmatchIndex(text, -1) {
+			age, gender := parseAgeGender(text, match)
+			if age == 0 {
+				continue
+			}
+			addPerson(Person{Role: roleBefore(text[:match[0]]), Age: age, Gender: gender})
+		}
+
+		// People mentioned as "my <relationship>" without a marker
+		for _, match := range myRolePattern.FindAllStringSubmatch(text, -1) {
+			if role, ok := relationshipAliases[strings.ToLower(match[1])]; ok {
+				addPerson(Person{Role: role})
+			}
+		}
+	}
+
+	return demographics
+}
+
+// IsEmpty reports whether nothing was extracted
+func (d *Demographics) IsEmpty() bool {
+	return d.Poster == nil && len(d.People) == 0
+}
+
+// parseAgeGender reads the age and gender from one ageGenderPattern match
+func parseAgeGender(text string, match []int) (int, string) {
+	group := func(i int) string {
+		if match[2*i] < 0 {
+			return ""
+		}
+		return text[match[2*i]:match[2*i+1]]
+	}
+
+	var ageText, genderText string
+	switch {
+	case group(1) != "":
+		ageText, genderText = group(1), group(2)
+	case group(3) != "":
+		genderText, ageText = group(3), group(4)
+	default:
+		ageText, genderText = group(5), group(6)
+	}
+
+	age, err := strconv.Atoi(ageText)
+	if err != nil || age < 5 || age > 99 {
+		return 0, ""
+	}
+	return age, strings.ToUpper(genderText)
+}
+
+// roleBefore works out who an age/gender marker describes from the few
+// words in front of it, e.g. "my husband (35M)" or "my sister Amy (24F)"
+func roleBefore(prefix string) string {
+	words := wordPattern.FindAllString(prefix, -1)
+	for i := len(words) - 1; i >= 0 && i >= len(words)-3; i-- {
+		word := strings.TrimSuffix(strings.ToLower(words[i]), "'s")
+		if posterWords[word] {
+			// "my (32F) husband" - the marker right after "my" is the poster
+			if i == len(words)-1 || word != "my" {
+				return "poster"
+			}
+			return "other"
+		}
+		if role, ok := relationshipAliases[word]; ok {
+			return role
+		}
+	}
+	return "other"
+}
+
+// ParseDemographicsJSON reads demographics returned by an LLM as JSON
+func ParseDemographicsJSON(response string) (*Demographics, error) {
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object in response")
+	}
+
+	var demographics Demographics
+	if err := json.Unmarshal([]byte(response[start:end+1]), &demographics); err != nil {
+		return nil, err
+	}
+	demographics.Source = "llm"
+
+	// Normalise the model's output to the same vocabulary as the regex parser
+	if demographics.Poster != nil {
+		demographics.Poster.Role = "poster"
+		demographics.Poster.Gender = strings.ToUpper(demographics.Poster.Gender)
+	}
+	for i := range demographics.People {
+		person := &demographics.People[i]
+		if role, ok := relationshipAliases[strings.ToLower(person.Role)]; ok {
+			person.Role = role
+		} else {
+			person.Role = strings.ToLower(person.Role)
+		}
+		person.Gender = strings.ToUpper(person.Gender)
+	}
+	return &demographics, nil
+}
+
+// DemographicsDimensions are the ways DemographicsBreakdown can group posts
+var DemographicsDimensions = []string{"poster_gender", "poster_age", "relationship"}
+
+// DemographicsBucket is one group of posts in a demographics breakdown
+type DemographicsBucket struct {
+	Value    string         `json:"value"`
+	Posts    int            `json:"posts"`
+	Verdicts map[string]int `json:"verdicts"` // Community verdict -> posts
+}
+
+// DemographicsBreakdown counts catalogued posts and their community verdicts
+// grouped by poster gender, poster age range or the relationships involved
+func (pc *PostCatalog) DemographicsBreakdown(ctx context.Context, dimension string) ([]DemographicsBucket, error) {
+	var field string
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"duplicate_of": bson.M{"$exists": false}}}},
+	}
+	switch dimension {
+	case "poster_gender":
+		field = "$demographics.poster.gender"
+	case "poster_age":
+		field = "$demographics.poster.age"
+	case "relationship":
+		field = "$demographics.people.role"
+		pipeline = append(pipeline, bson.D{{Key: "$unwind", Value: "$demographics.people"}})
+	default:
+		return nil, fmt.Errorf("unknown dimension %q", dimension)
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$group", Value: bson.M{
+		"_id":   bson.M{"value": field, "verdict": "$community_verdict"},
+		"count": bson.M{"$sum": 1},
+	}}})
+
+	cursor, err := pc.posts.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		ID struct {
+			Value   interface{} `bson:"value"`
+			Verdict string      `bson:"verdict"`
+		} `bson:"_id"`
+		Count int `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	buckets := make(map[string]*DemographicsBucket)
+	for _, row := range rows {
+		value := bucketValue(dimension, row.ID.Value)
+		bucket, ok := buckets[value]
+		if !ok {
+			bucket = &DemographicsBucket{Value: value, Verdicts: make(map[string]int)}
+			buckets[value] = bucket
+		}
+		bucket.Posts += row.Count
+		if row.ID.Verdict != "" {
+			bucket.Verdicts[row.ID.Verdict] += row.Count
+		}
+	}
+
+	results := make([]DemographicsBucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		results = append(results, *bucket)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Posts != results[j].Posts {
+			return results[i].Posts > results[j].Posts
+		}
+		return results[i].Value < results[j].Value
+	})
+	return results, nil
+}
+
+// bucketValue turns a grouped field into a label, putting ages into ranges
+func bucketValue(dimension string, value interface{}) string {
+	if dimension == "poster_age" {
+		var age int
+		switch v := value.(type) {
+		case int32:
+			age = int(v)
+		case int64:
+			age = int(v)
+		}
+		return AgeRange(age)
+	}
+	if s, ok := value.(string); ok && s != "" {
+		return s
+	}
+	return "unknown"
+}
+
+// AgeRange returns the analytics age bracket for an age, or "unknown" for 0
+func AgeRange(age int) string {
+	switch {
+	case age <= 0:
+		return "unknown"
+	case age < 18:
+		return "under 18"
+	case age < 25:
+		return "18-24"
+	case age < 35:
+		return "25-34"
+	case age < 45:
+		return "35-44"
+	case age < 55:
+		return "45-54"
+	default:
+		return "55+"
+	}
+}
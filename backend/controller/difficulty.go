@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Difficulty model. A post's difficulty is the chance a player gets it
+// wrong. The comment split gives the starting estimate (a 95/5 post is easy,
+// a 50/50 one is a coin flip), which our own players' answers then refine.
+const (
+	DifficultyPriorWeight = 10   // How many player answers the comment split is worth
+	DefaultDifficulty     = 0.25 // For posts with no comment verdicts or answers yet
+)
+
+// Feed orders
+const (
+	SortNewest  = "newest"
+	SortHardest = "hardest"
+	SortEasiest = "easiest"
+)
+
+// PostDifficulty is how hard a post is to call
+type PostDifficulty struct {
+	Score     float64   `json:"score" bson:"score"`   // Chance a player gets it wrong, from 0 to 1
+	Rating    float64   `json:"rating" bson:"rating"` // Item response difficulty in logits, 0 is a coin flip
+	Players   int       `json:"players" bson:"players"`
+	Incorrect int       `json:"incorrect" bson:"incorrect"`
+	UpdatedAt time.Time `json:"-" bson:"updated_at"`
+}
+
+// EstimateDifficulty combines the comment verdict split with how many
+// players got the post wrong. It treats the split as DifficultyPriorWeight
+// answers, so a handful of players only nudges it but hundreds outweigh it.
+func EstimateDifficulty(counts map[string]int, players, incorrect int) PostDifficulty {
+	yta, nta := 0, 0
+	for verdict, count := range counts {
+		switch VerdictSide(verdict) {
+		case VerdictYTA:
+			yta += count
+		case VerdictNTA:
+			nta += count
+		}
+	}
+	prior := DefaultDifficulty
+	if yta+nta > 0 {
+		prior = float64(min(yta, nta)) / float64(yta+nta)
+	}
+
+	score := (float64(incorrect) + prior*DifficultyPriorWeight) / (float64(players) + DifficultyPriorWeight)
+	clamped := math.Max(0.01, math.Min(0.99, score))
+	return PostDifficulty{
+		Score:     math.Round(score*1000) / 1000,
+		Rating:    math.Round(math.Log(clamped/(1-clamped))*1000) / 1000,
+		Players:   players,
+		Incorrect: incorrect,
+	}
+}
+
+// DifficultyScore returns the post's stored difficulty score, or an estimate
+// from its comments if it hasn't been rated yet
+func (p *Post) DifficultyScore() float64 {
+	if p.Difficulty != nil {
+		return p.Difficulty.Score
+	}
+	return EstimateDifficulty(p.VerdictCounts, 0, 0).Score
+}
+
+// refreshDifficulty recomputes a catalogued post's difficulty from its
+// comments and every scored answer on it. Posts that aren't catalogued are
+// skipped.
+func refreshDifficulty(ctx context.Context, posts, judgments *mongo.Collection, postID string) error {
+	var post Post
+	err := posts.FindOne(ctx, bson.M{"post_id": postID}, options.FindOne().SetProjection(bson.M{"verdict_counts": 1})).Decode(&post)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	scored := bson.M{"post_id": postID, "undone_at": bson.M{"$exists": false}, "correct": bson.M{"$exists": true}}
+	players, err := judgments.CountDocuments(ctx, scored)
+	if err != nil {
+		return err
+	}
+	scored["correct"] = false
+	incorrect, err := judgments.CountDocuments(ctx, scored)
+	if err != nil {
+		return err
+	}
+
+	difficulty := EstimateDifficulty(post.VerdictCounts, int(players), int(incorrect))
+	difficulty.UpdatedAt = time.Now()
+	_, err = posts.UpdateOne(ctx, bson.M{"post_id": postID}, bson.M{"$set": bson.M{"difficulty": difficulty}})
+	return err
+}
+
+// RefreshDifficulty recomputes the difficulty of every catalogued post from
+// its comment verdicts and player answers
+func (pc *PostCatalog) RefreshDifficulty(ctx context.Context) (int, error) {
+	cursor, err := pc.posts.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"post_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	refreshed := 0
+	for cursor.Next(ctx) {
+		var post Post
+		if err := cursor.Decode(&post); err != nil {
+			return refreshed, err
+		}
+		if err := refreshDifficulty(ctx, pc.posts, pc.judgments, post.PostID); err != nil {
+			return refreshed, err
+		}
+		refreshed++
+	}
+	return refreshed, cursor.Err()
+}
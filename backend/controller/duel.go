@@ -0,0 +1,576 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Duel settings
+const (
+	DuelSize     = 5              // Posts in each duel
+	DuelDuration = 48 * time.Hour // Time from the challenge for both players to play
+)
+
+// Duel statuses
+const (
+	DuelPending   = "pending"   // Waiting for the opponent to accept
+	DuelActive    = "active"    // Accepted, waiting for answers
+	DuelCompleted = "completed" // Both players answered, or one did and time ran out
+	DuelDeclined  = "declined"
+	DuelExpired   = "expired" // Time ran out before anyone could win
+)
+
+// Duel results, from one player's side
+const (
+	DuelWin  = "win"
+	DuelLoss = "loss"
+	DuelDraw = "draw"
+)
+
+// ErrNoDuelPosts means the catalogue doesn't have enough scored posts that
+// neither player has judged
+var ErrNoDuelPosts = errors.New("not enough unjudged posts for a duel")
+
+// DuelRecord is a player's duel results
+type DuelRecord struct {
+	Wins   int `json:"wins" bson:"wins"`
+	Losses int `json:"losses" bson:"losses"`
+	Draws  int `json:"draws" bson:"draws"`
+}
+
+// DuelPlayer is one side of a duel
+type DuelPlayer struct {
+	Username    string        `json:"username" bson:"username"`
+	Answers     []DailyAnswer `json:"answers,omitempty" bson:"answers,omitempty"`
+	Score       int           `json:"score" bson:"score"`
+	SubmittedAt *time.Time    `json:"submitted_at,omitempty" bson:"submitted_at,omitempty"`
+}
+
+// Duel is a head-to-head challenge where both players judge the same posts
+type Duel struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Challenger  DuelPlayer         `json:"challenger" bson:"challenger"`
+	Opponent    DuelPlayer         `json:"opponent" bson:"opponent"`
+	PostIDs     []string           `json:"post_ids" bson:"post_ids"`
+	Status      string             `json:"status" bson:"status"`
+	Winner      string             `json:"winner,omitempty" bson:"winner,omitempty"` // Empty for a draw
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	ExpiresAt   time.Time          `json:"expires_at" bson:"expires_at"`
+	CompletedAt *time.Time         `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+}
+
+// player returns the side of the duel the user is on, and the other side
+func (d *Duel) player(username string) (*DuelPlayer, *DuelPlayer) {
+	switch username {
+	case d.Challenger.Username:
+		return &d.Challenger, &d.Opponent
+	case d.Opponent.Username:
+		return &d.Opponent, &d.Challenger
+	default:
+		return nil, nil
+	}
+}
+
+// field returns the document field holding the user's side
+func (d *Duel) field(username string) string {
+	if username == d.Challenger.Username {
+		return "challenger"
+	}
+	return "opponent"
+}
+
+// DecideDuel returns the winner of a finished duel, or "" for a draw. A
+// player who answered beats one who didn't.
+func DecideDuel(d *Duel) string {
+	a, b := d.Challenger, d.Opponent
+	switch {
+	case a.SubmittedAt == nil && b.SubmittedAt == nil:
+		return ""
+	case b.SubmittedAt == nil || (a.SubmittedAt != nil && a.Score > b.Score):
+		return a.Username
+	case a.SubmittedAt == nil || b.Score > a.Score:
+		return b.Username
+	default:
+		return ""
+	}
+}
+
+// createDuelIndexes supports listing a player's duels and finding expired ones
+func (uc *UserController) createDuelIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := uc.duels.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "challenger.username", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "opponent.username", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}}},
+	})
+	if err != nil {
+		fmt.Println("Failed to create duel indexes:", err)
+	}
+}
+
+// finishDuel settles a duel once and records the result on both players.
+// Only the request that moves the duel out of from gets to record it.
+func (uc *UserController) finishDuel(ctx context.Context, duel *Duel, from []string) error {
+	now := uc.now()
+	status := DuelCompleted
+	if duel.Status == DuelPending || (duel.Challenger.SubmittedAt == nil && duel.Opponent.SubmittedAt == nil) {
+		status = DuelExpired
+	}
+	// Only a played duel has a winner
+	winner := ""
+	if status == DuelCompleted {
+		winner = DecideDuel(duel)
+	}
+
+	set := bson.M{"status": status, "completed_at": now}
+	if winner != "" {
+		set["winner"] = winner
+	}
+	result, err := uc.duels.UpdateOne(ctx,
+		bson.M{"_id": duel.ID, "status": bson.M{"$in": from}},
+		bson.M{"$set": set},
+	)
+	if err != nil || result.ModifiedCount == 0 {
+		return err
+	}
+	duel.Status = status
+	duel.Winner = winner
+	duel.CompletedAt = &now
+	if status != DuelCompleted {
+		return nil
+	}
+
+	for _, player := range []string{duel.Challenger.Username, duel.Opponent.Username} {
+		field := "duels.draws"
+		if winner == player {
+			field = "duels.wins"
+		} else if winner != "" {
+			field = "duels.losses"
+		}
+		if _, err := uc.collection.UpdateOne(ctx, bson.M{"username": player}, bson.M{"$inc": bson.M{field: 1}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// duelPostIDs returns the posts in duels that are still being played
+func (uc *UserController) duelPostIDs(ctx context.Context) ([]string, error) {
+	cursor, err := uc.duels.Find(ctx,
+		bson.M{"status": bson.M{"$in": []string{DuelPending, DuelActive}}, "expires_at": bson.M{"$gt": uc.now()}},
+		options.Find().SetProjection(bson.M{"post_ids": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var duels []Duel
+	if err := cursor.All(ctx, &duels); err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, duel := range duels {
+		ids = append(ids, duel.PostIDs...)
+	}
+	return ids, nil
+}
+
+// expireDuels settles the user's duels whose time has run out. A player who
+// answered wins against one who didn't.
+func (uc *UserController) expireDuels(ctx context.Context, username string) error {
+	cursor, err := uc.duels.Find(ctx, bson.M{
+		"$or":        bson.A{bson.M{"challenger.username": username}, bson.M{"opponent.username": username}},
+		"status":     bson.M{"$in": []string{DuelPending, DuelActive}},
+		"expires_at": bson.M{"$lte": uc.now()},
+	})
+	if err != nil {
+		return err
+	}
+	var duels []Duel
+	if err := cursor.All(ctx, &duels); err != nil {
+		return err
+	}
+	for i := range duels {
+		if err := uc.finishDuel(ctx, &duels[i], []string{duels[i].Status}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findDuel loads a duel the user is part of, settling it first if it has expired
+func (uc *UserController) findDuel(ctx context.Context, id, username string) (*Duel, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, mongo.ErrNoDocuments
+	}
+	var duel Duel
+	err = uc.duels.FindOne(ctx, bson.M{
+		"_id": objectID,
+		"$or": bson.A{bson.M{"challenger.username": username}, bson.M{"opponent.username": username}},
+	}).Decode(&duel)
+	if err != nil {
+		return nil, err
+	}
+	if (duel.Status == DuelPending || duel.Status == DuelActive) && !uc.now().Before(duel.ExpiresAt) {
+		if err := uc.finishDuel(ctx, &duel, []string{duel.Status}); err != nil {
+			return nil, err
+		}
+	}
+	return &duel, nil
+}
+
+// duelView returns what the user may see of a duel: the other player's
+// answers and the verdicts stay hidden until the duel is over
+func (uc *UserController) duelView(ctx context.Context, duel *Duel, username string) (gin.H, error) {
+	posts, err := uc.orderedPosts(ctx, duel.PostIDs)
+	if err != nil {
+		return nil, err
+	}
+	over := duel.Status == DuelCompleted || duel.Status == DuelExpired || duel.Status == DuelDeclined
+	me, other := duel.player(username)
+	view := *duel
+	if !over {
+		hideVerdicts(posts)
+		hidden := DuelPlayer{Username: other.Username, SubmittedAt: other.SubmittedAt}
+		if other == &duel.Challenger {
+			view.Challenger = hidden
+		} else {
+			view.Opponent = hidden
+		}
+		// Answers are kept, but not which were right
+		mine := *me
+		mine.Answers = nil
+		for _, answer := range me.Answers {
+			mine.Answers = append(mine.Answers, DailyAnswer{PostID: answer.PostID, Verdict: answer.Verdict})
+		}
+		mine.Score = 0
+		if me == &duel.Challenger {
+			view.Challenger = mine
+		} else {
+			view.Opponent = mine
+		}
+	}
+
+	response := gin.H{"duel": view, "posts": posts}
+	if over && duel.Status == DuelCompleted {
+		switch duel.Winner {
+		case "":
+			response["result"] = DuelDraw
+		case username:
+			response["result"] = DuelWin
+		default:
+			response["result"] = DuelLoss
+		}
+	}
+	return response, nil
+}
+
+// CreateDuel challenges another player to judge the same posts. The posts
+// are ones neither player has judged.
+func (uc *UserController) CreateDuel(c *gin.Context) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		Opponent string `json:"opponent" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+	if req.Opponent == username {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't duel yourself"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var judged []string
+	for _, player := range []string{username, req.Opponent} {
+		var user User
+		err := uc.collection.FindOne(ctx, bson.M{"username": player}, options.FindOne().SetProjection(bson.M{"post_history": 1})).Decode(&user)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found", "username": player})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find user", "details": err.Error()})
+			return
+		}
+		for postID := range user.PostHistory {
+			judged = append(judged, postID)
+		}
+	}
+
+	candidates, err := uc.scorablePostIDs(ctx, judged)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to choose posts", "details": err.Error()})
+		return
+	}
+	if len(candidates) < DuelSize {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": ErrNoDuelPosts.Error()})
+		return
+	}
+
+	now := uc.now()
+	duel := Duel{
+		ID:         primitive.NewObjectID(),
+		Challenger: DuelPlayer{Username: username},
+		Opponent:   DuelPlayer{Username: req.Opponent},
+		Status:     DuelPending,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(DuelDuration),
+	}
+	duel.PostIDs = SelectDailyPosts(candidates, duel.ID.Hex(), DuelSize)
+	if _, err := uc.duels.InsertOne(ctx, duel); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create duel", "details": err.Error()})
+		return
+	}
+
+	response, err := uc.duelView(ctx, &duel, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load duel posts", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetDuels lists the user's duels, newest first, with their record
+func (uc *UserController) GetDuels(c *gin.Context) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := uc.expireDuels(ctx, username); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to settle expired duels", "details": err.Error()})
+		return
+	}
+
+	filter := bson.M{"$or": bson.A{bson.M{"challenger.username": username}, bson.M{"opponent.username": username}}}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+	cursor, err := uc.duels.Find(ctx, filter,
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}}).
+			SetLimit(50).
+			SetProjection(bson.M{"challenger.answers": 0, "opponent.answers": 0}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve duels", "details": err.Error()})
+		return
+	}
+	duels := []Duel{}
+	if err := cursor.All(ctx, &duels); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode duels", "details": err.Error()})
+		return
+	}
+	// Scores would give away answers while the duel is still on
+	for i := range duels {
+		if duels[i].Status == DuelPending || duels[i].Status == DuelActive {
+			duels[i].Challenger.Score = 0
+			duels[i].Opponent.Score = 0
+		}
+	}
+
+	var user User
+	err = uc.collection.FindOne(ctx, bson.M{"username": username}, options.FindOne().SetProjection(bson.M{"duels": 1})).Decode(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find user", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"duels": duels, "record": user.Duels})
+}
+
+// GetDuel returns one of the user's duels with its posts
+func (uc *UserController) GetDuel(c *gin.Context) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	duel, err := uc.findDuel(ctx, c.Param("id"), username)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Duel not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load duel", "details": err.Error()})
+		return
+	}
+
+	response, err := uc.duelView(ctx, duel, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load duel posts", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// AcceptDuel accepts a duel the user was challenged to
+func (uc *UserController) AcceptDuel(c *gin.Context) {
+	uc.respondToDuel(c, true)
+}
+
+// DeclineDuel declines a duel the user was challenged to
+func (uc *UserController) DeclineDuel(c *gin.Context) {
+	uc.respondToDuel(c, false)
+}
+
+// respondToDuel moves a pending duel on to active or declined
+func (uc *UserController) respondToDuel(c *gin.Context, accept bool) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	duel, err := uc.findDuel(ctx, c.Param("id"), username)
+	if errors.Is(err, mongo.ErrNoDocuments) || (err == nil && duel.Opponent.Username != username) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Duel not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load duel", "details": err.Error()})
+		return
+	}
+
+	status := DuelDeclined
+	if accept {
+		status = DuelActive
+	}
+	result, err := uc.duels.UpdateOne(ctx,
+		bson.M{"_id": duel.ID, "status": DuelPending},
+		bson.M{"$set": bson.M{"status": status}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update duel", "details": err.Error()})
+		return
+	}
+	if result.ModifiedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "This duel is already " + duel.Status})
+		return
+	}
+	duel.Status = status
+
+	response, err := uc.duelView(ctx, duel, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load duel posts", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// SubmitDuel scores the user's answers to a duel's posts. The challenger can
+// answer straight away; the opponent answers once they've accepted. Each
+// player answers once, and the duel is decided when both have.
+func (uc *UserController) SubmitDuel(c *gin.Context) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		Answers map[string]string `json:"answers" binding:"required"` // Map of post_id to YTA or NTA
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	duel, err := uc.findDuel(ctx, c.Param("id"), username)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Duel not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load duel", "details": err.Error()})
+		return
+	}
+	field := duel.field(username)
+	allowed := []string{DuelActive}
+	if field == "challenger" {
+		allowed = append(allowed, DuelPending)
+	}
+
+	posts, err := uc.orderedPosts(ctx, duel.PostIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load duel posts", "details": err.Error()})
+		return
+	}
+	answers, score, err := scoreAnswers(posts, req.Answers)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := uc.now()
+	err = uc.duels.FindOneAndUpdate(ctx,
+		bson.M{
+			"_id":                   duel.ID,
+			"status":                bson.M{"$in": allowed},
+			field + ".submitted_at": bson.M{"$exists": false},
+			"expires_at":            bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{
+			field + ".answers":      answers,
+			field + ".score":        score,
+			field + ".submitted_at": now,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(duel)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusConflict, gin.H{"error": "You can't answer this duel now", "status": duel.Status})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save answers", "details": err.Error()})
+		return
+	}
+
+	if duel.Challenger.SubmittedAt != nil && duel.Opponent.SubmittedAt != nil {
+		if err := uc.finishDuel(ctx, duel, []string{DuelActive}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to settle duel", "details": err.Error()})
+			return
+		}
+	}
+
+	response, err := uc.duelView(ctx, duel, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load duel posts", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
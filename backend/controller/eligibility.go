@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// wilsonZ is the z-score for the 95% confidence Wilson lower bound
+const wilsonZ = 1.96
+
+// Eligibility requirements
+const (
+	RequirementMinJudgments = "min_judgments"
+	RequirementAccountAge   = "account_age"
+)
+
+// EligibilityRules decide who can be ranked on the accuracy leaderboard, so
+// a player with one lucky answer doesn't sit at 100%
+type EligibilityRules struct {
+	MinJudgments  int // Scored judgments needed within the leaderboard's period
+	MinAccountAge time.Duration
+}
+
+// DefaultEligibilityRules are used unless main configures others
+var DefaultEligibilityRules = EligibilityRules{MinJudgments: 20, MinAccountAge: 3 * 24 * time.Hour}
+
+// EligibilityGap is a requirement a player hasn't met yet
+type EligibilityGap struct {
+	Requirement string `json:"requirement"`
+	Needed      int    `json:"needed"`
+	Current     int    `json:"current"`
+	Message     string `json:"message"`
+}
+
+// Missing returns the requirements a player with scored judgments and an
+// account created at createdAt hasn't met by now
+func (r EligibilityRules) Missing(scored int, createdAt, now time.Time) []EligibilityGap {
+	var gaps []EligibilityGap
+	if scored < r.MinJudgments {
+		gaps = append(gaps, EligibilityGap{
+			Requirement: RequirementMinJudgments,
+			Needed:      r.MinJudgments,
+			Current:     scored,
+			Message:     fmt.Sprintf("Judge %d more scored posts", r.MinJudgments-scored),
+		})
+	}
+	if age := now.Sub(createdAt); age < r.MinAccountAge {
+		needed := int(math.Ceil(r.MinAccountAge.Hours() / 24))
+		current := int(age.Hours() / 24)
+		gaps = append(gaps, EligibilityGap{
+			Requirement: RequirementAccountAge,
+			Needed:      needed,
+			Current:     current,
+			Message:     fmt.Sprintf("Account must be %d days old", needed),
+		})
+	}
+	return gaps
+}
+
+// SetEligibilityRules replaces the accuracy leaderboard's eligibility rules
+func (uc *UserController) SetEligibilityRules(rules EligibilityRules) {
+	uc.eligibility = rules
+}
+
+// WilsonLowerBound returns the lower bound of the 95% confidence interval
+// for a player's true accuracy, as a percentage. It is what the accuracy
+// leaderboard ranks by: 9/10 correct scores lower than 90/100.
+func WilsonLowerBound(correct, scored int) float64 {
+	if scored == 0 {
+		return 0
+	}
+	n := float64(scored)
+	p := float64(correct) / n
+	z2 := wilsonZ * wilsonZ
+	bound := (p + z2/(2*n) - wilsonZ*math.Sqrt(p*(1-p)/n+z2/(4*n*n))) / (1 + z2/n)
+	return math.Round(bound*1000) / 10
+}
+
+// wilsonScore is WilsonLowerBound as an aggregation expression over the
+// scored and correct fields
+var wilsonScore = bson.M{"$cond": bson.A{
+	bson.M{"$gt": bson.A{"$scored", 0}},
+	bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{100, bson.M{"$let": bson.M{
+		"vars": bson.M{"n": "$scored", "p": bson.M{"$divide": bson.A{"$correct", "$scored"}}},
+		"in": bson.M{"$divide": bson.A{
+			bson.M{"$subtract": bson.A{
+				bson.M{"$add": bson.A{"$$p", bson.M{"$divide": bson.A{wilsonZ * wilsonZ, bson.M{"$multiply": bson.A{2, "$$n"}}}}}},
+				bson.M{"$multiply": bson.A{wilsonZ, bson.M{"$sqrt": bson.M{"$add": bson.A{
+					bson.M{"$divide": bson.A{bson.M{"$multiply": bson.A{"$$p", bson.M{"$subtract": bson.A{1, "$$p"}}}}, "$$n"}},
+					bson.M{"$divide": bson.A{wilsonZ * wilsonZ, bson.M{"$multiply": bson.A{4, "$$n", "$$n"}}}},
+				}}}}},
+			}},
+			bson.M{"$add": bson.A{1, bson.M{"$divide": bson.A{wilsonZ * wilsonZ, "$$n"}}}},
+		}},
+	}}}}, 1}},
+	0,
+}}
+
+// withEligibility limits the leaderboard to players who meet the rules at
+// the given time. Lifetime leaderboards match the stored counts, so the
+// indexes still apply; period ones count the scored judgments in the period,
+// which the player stages already total.
+func (uc *UserController) withEligibility(q leaderboardQuery, lifetime bool, at time.Time) leaderboardQuery {
+	if lifetime {
+		q.eligible = bson.M{
+			"scored_judgments": bson.M{"$gte": uc.eligibility.MinJudgments},
+			"created_at":       bson.M{"$lte": at.Add(-uc.eligibility.MinAccountAge)},
+		}
+	} else {
+		players := append(mongo.Pipeline{}, q.players...)
+		players = append(players,
+			bson.D{{Key: "$lookup", Value: bson.M{"from": uc.collection.Name(), "localField": "username", "foreignField": "username", "as": "account"}}},
+			bson.D{{Key: "$addFields", Value: bson.M{"created_at": bson.M{"$first": "$account.created_at"}}}},
+			bson.D{{Key: "$project", Value: bson.M{"account": 0}}},
+			bson.D{{Key: "$addFields", Value: bson.M{"eligible": bson.M{"$and": bson.A{
+				bson.M{"$gte": bson.A{"$scored", uc.eligibility.MinJudgments}},
+				bson.M{"$lte": bson.A{"$created_at", at.Add(-uc.eligibility.MinAccountAge)}},
+			}}}}},
+		)
+		q.players = players
+		q.eligible = bson.M{"eligible": true}
+	}
+
+	q.match = q.eligible
+	q.eligibility = &uc.eligibility
+	q.at = at
+	return q
+}
+
+// ineligible returns the query for the players the eligibility rules leave out
+func (q leaderboardQuery) ineligible() leaderboardQuery {
+	q.match = bson.M{"$nor": bson.A{q.eligible}}
+	return q
+}
+
+// annotate lists what each player is missing to be eligible
+func (q leaderboardQuery) annotate(entries []LeaderboardEntry) {
+	if q.eligibility == nil {
+		return
+	}
+	for i := range entries {
+		entries[i].Missing = q.eligibility.Missing(entries[i].Scored, entries[i].CreatedAt, q.at)
+	}
+}
@@ -0,0 +1,985 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Where a judgment was made
+const (
+	SourceFeed      = "feed"      // Swiping through the main feed
+	SourceMigration = "migration" // Copied from a legacy post_history map
+)
+
+// UndoWindow is how long after judging a post the player can undo it or
+// change their answer without it counting. After that the first answer is
+// committed and is the one that gets scored.
+const UndoWindow = 10 * time.Second
+
+// Revision actions
+const (
+	RevisionChange  = "change"
+	RevisionUndo    = "undo"
+	RevisionRejudge = "rejudge" // Judged again after undoing
+)
+
+var (
+	ErrJudgmentNotFound  = errors.New("judgment not found")
+	ErrUndoWindowExpired = errors.New("undo window has expired")
+	ErrJudgmentUnchanged = errors.New("verdict is unchanged")
+)
+
+// JudgmentRevision is one entry in a judgment's audit trail
+type JudgmentRevision struct {
+	Action string    `json:"action" bson:"action"`
+	From   string    `json:"from,omitempty" bson:"from,omitempty"`
+	To     string    `json:"to,omitempty" bson:"to,omitempty"`
+	Scored bool      `json:"scored" bson:"scored"` // Whether the revision changed the scored answer
+	At     time.Time `json:"at" bson:"at"`
+}
+
+// Judgment is one user's verdict on one post
+type Judgment struct {
+	ID               primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Username         string             `json:"username" bson:"username"`
+	PostID           string             `json:"post_id" bson:"post_id"`
+	Verdict          string             `json:"verdict" bson:"verdict"`               // Current answer
+	ScoredVerdict    string             `json:"scored_verdict" bson:"scored_verdict"` // First committed answer
+	CommunityVerdict string             `json:"community_verdict,omitempty" bson:"community_verdict,omitempty"`
+	Correct          *bool              `json:"correct,omitempty" bson:"correct,omitempty"` // Unset until the community has a verdict
+	Subreddit        string             `json:"subreddit,omitempty" bson:"subreddit,omitempty"`
+	Tags             []string           `json:"tags,omitempty" bson:"tags,omitempty"`
+	LatencyMs        int64              `json:"latency_ms,omitempty" bson:"latency_ms,omitempty"` // Time the user took to decide
+	Difficulty       float64            `json:"difficulty" bson:"difficulty"`                     // How hard the post was to call, from 0 to 1
+	Streak           int                `json:"streak" bson:"streak"`                             // The user's streak on the day they judged
+	RatingChange     *RatingChange      `json:"rating_change,omitempty" bson:"rating_change,omitempty"`
+	ContrarianWin    bool               `json:"contrarian_win,omitempty" bson:"contrarian_win,omitempty"` // Counted towards the user's contrarian wins
+	Source           string             `json:"source" bson:"source"`
+	CreatedAt        time.Time          `json:"created_at" bson:"created_at"`
+	FirstJudgedAt    *time.Time         `json:"first_judged_at,omitempty" bson:"first_judged_at,omitempty"` // Set when judged again after an undo
+	UndoneAt         *time.Time         `json:"undone_at,omitempty" bson:"undone_at,omitempty"`
+	Revisions        []JudgmentRevision `json:"revisions,omitempty" bson:"revisions,omitempty"`
+}
+
+// InUndoWindow reports whether the judgment can still be undone or changed
+// without the change being recorded as a revision of a committed answer. The
+// window runs from when the post was first judged, so undoing and judging
+// again doesn't reopen it.
+func (j *Judgment) InUndoWindow(now time.Time) bool {
+	return !now.After(j.UndoUntil())
+}
+
+// UndoUntil returns when the judgment's undo window closes
+func (j *Judgment) UndoUntil() time.Time {
+	if j.FirstJudgedAt != nil {
+		return j.FirstJudgedAt.Add(UndoWindow)
+	}
+	return j.CreatedAt.Add(UndoWindow)
+}
+
+// hideAnswer leaves out everything that gives away the community verdict
+func (j Judgment) hideAnswer() Judgment {
+	j.CommunityVerdict = ""
+	j.Correct = nil
+	j.ContrarianWin = false
+	j.RatingChange = nil
+	return j
+}
+
+// forResponse returns the judgment as it can be shown to the player. While
+// the answer can still be changed the community verdict is hidden, so the
+// player can't read it and switch to it.
+func (j Judgment) forResponse(now time.Time) Judgment {
+	if j.InUndoWindow(now) {
+		return j.hideAnswer()
+	}
+	return j
+}
+
+// JudgmentFilter narrows a user's judgment history. Zero values don't filter.
+type JudgmentFilter struct {
+	Verdict   string
+	Correct   *bool
+	Subreddit string
+	Source    string
+	Tag       string
+	From      time.Time
+	To        time.Time
+	Limit     int
+	Offset    int
+
+	IncludeUndone bool
+}
+
+// createJudgmentIndexes sets up the indexes history queries rely on
+func (uc *UserController) createJudgmentIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := uc.judgments.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "username", Value: 1}, {Key: "post_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "username", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "post_id", Value: 1}}},
+	})
+	if err != nil {
+		fmt.Println("Failed to create judgments indexes:", err)
+	}
+}
+
+// recordJudgment stores a user's verdict on a post along with what the
+// catalogue knows about the post at the time. Judging a post again counts as
+// changing the existing answer, which is returned as the previous judgment;
+// previous is nil for a new judgment.
+func (uc *UserController) recordJudgment(ctx context.Context, username, postID, verdict string, latencyMs int64, source string) (judgment, previous *Judgment, err error) {
+	var existing Judgment
+	err = uc.judgments.FindOne(ctx, bson.M{"username": username, "post_id": postID}).Decode(&existing)
+	if err == nil && existing.UndoneAt == nil {
+		judgment, err := uc.changeJudgment(ctx, &existing, verdict)
+		if errors.Is(err, ErrJudgmentUnchanged) {
+			err = nil
+		}
+		return judgment, &existing, err
+	}
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil, err
+	}
+
+	now := uc.now()
+	judgment = &Judgment{
+		Username:      username,
+		PostID:        postID,
+		Verdict:       verdict,
+		ScoredVerdict: verdict,
+		LatencyMs:     latencyMs,
+		Source:        source,
+		CreatedAt:     now,
+	}
+	if err == nil {
+		// Judging again after an undo keeps the audit trail and the original
+		// undo window. Once that has passed the undone answer is the one that
+		// counts.
+		first := existing.CreatedAt
+		if existing.FirstJudgedAt != nil {
+			first = *existing.FirstJudgedAt
+		}
+		judgment.ID = existing.ID
+		judgment.FirstJudgedAt = &first
+		revision := JudgmentRevision{Action: RevisionRejudge, To: verdict, Scored: true, At: now}
+		if !judgment.InUndoWindow(now) {
+			judgment.ScoredVerdict = existing.ScoredVerdict
+			revision.Scored = false
+		}
+		judgment.Revisions = append(existing.Revisions, revision)
+	}
+
+	var post Post
+	err = uc.posts.FindOne(ctx, bson.M{"post_id": postID}).Decode(&post)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil, err
+	}
+	judgment.applyPost(post)
+	// Difficulty is fixed now, before this answer counts towards it
+	judgment.Difficulty = post.DifficultyScore()
+
+	result, err := uc.judgments.ReplaceOne(ctx,
+		bson.M{"username": username, "post_id": postID},
+		judgment,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	if id, ok := result.UpsertedID.(primitive.ObjectID); ok {
+		judgment.ID = id
+	}
+	return judgment, nil, nil
+}
+
+// changeJudgment switches a judgment to a new verdict and returns the changed
+// copy. Inside the undo window the new verdict replaces the scored answer;
+// afterwards it is only recorded.
+func (uc *UserController) changeJudgment(ctx context.Context, previous *Judgment, verdict string) (*Judgment, error) {
+	if previous.Verdict == verdict {
+		return previous, ErrJudgmentUnchanged
+	}
+
+	now := uc.now()
+	judgment := *previous
+	revision := JudgmentRevision{Action: RevisionChange, From: judgment.Verdict, To: verdict, At: now}
+	judgment.Verdict = verdict
+	if judgment.InUndoWindow(now) {
+		revision.Scored = true
+		judgment.ScoredVerdict = verdict
+		judgment.score()
+		// The win was for the answer being replaced
+		judgment.ContrarianWin = false
+	}
+	judgment.Revisions = append(append([]JudgmentRevision{}, previous.Revisions...), revision)
+
+	set := bson.M{"verdict": judgment.Verdict, "scored_verdict": judgment.ScoredVerdict, "contrarian_win": judgment.ContrarianWin}
+	if judgment.Correct != nil {
+		set["correct"] = *judgment.Correct
+	}
+	_, err := uc.judgments.UpdateOne(ctx,
+		bson.M{"_id": judgment.ID},
+		bson.M{"$set": set, "$push": bson.M{"revisions": revision}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &judgment, nil
+}
+
+// undoJudgment withdraws a judgment made within the undo window. The record
+// is kept, marked as undone, for the audit trail.
+func (uc *UserController) undoJudgment(ctx context.Context, username, postID string) (*Judgment, error) {
+	var judgment Judgment
+	err := uc.judgments.FindOne(ctx, bson.M{"username": username, "post_id": postID, "undone_at": bson.M{"$exists": false}}).Decode(&judgment)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrJudgmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := uc.now()
+	if !judgment.InUndoWindow(now) {
+		return nil, ErrUndoWindowExpired
+	}
+
+	revision := JudgmentRevision{Action: RevisionUndo, From: judgment.Verdict, Scored: true, At: now}
+	judgment.UndoneAt = &now
+	judgment.Revisions = append(judgment.Revisions, revision)
+	_, err = uc.judgments.UpdateOne(ctx,
+		bson.M{"_id": judgment.ID},
+		bson.M{"$set": bson.M{"undone_at": now}, "$push": bson.M{"revisions": revision}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &judgment, nil
+}
+
+// applyPost fills in the judgment fields that come from the post. The
+// difficulty isn't one of them: it is fixed when the post is judged, so the
+// XP a judgment earned doesn't drift as other players answer.
+func (j *Judgment) applyPost(post Post) {
+	j.Subreddit = post.Subreddit
+	j.Tags = post.Tags
+	j.CommunityVerdict = post.CommunityVerdict
+	j.score()
+}
+
+// difficultyWithout returns the post's difficulty leaving out the judgment's
+// own answer, which is the closest to what it was when the post was judged
+func difficultyWithout(post Post, judgment *Judgment) float64 {
+	if post.Difficulty == nil || judgment.Correct == nil || post.Difficulty.Players == 0 {
+		return post.DifficultyScore()
+	}
+	incorrect := post.Difficulty.Incorrect
+	if !*judgment.Correct && incorrect > 0 {
+		incorrect--
+	}
+	return EstimateDifficulty(post.VerdictCounts, post.Difficulty.Players-1, incorrect).Score
+}
+
+// score marks the scored answer correct or not once the community has a verdict
+func (j *Judgment) score() {
+	if side := VerdictSide(j.CommunityVerdict); side != "" {
+		correct := side == j.ScoredVerdict
+		j.Correct = &correct
+	}
+}
+
+// ListJudgments returns a page of a user's judgments, newest first, and the
+// total number matching the filter. Answers that can still be changed are
+// hidden.
+func (uc *UserController) ListJudgments(ctx context.Context, username string, filter JudgmentFilter) ([]Judgment, int64, error) {
+	query := bson.M{"username": username}
+	if !filter.IncludeUndone {
+		query["undone_at"] = bson.M{"$exists": false}
+	}
+	if filter.Verdict != "" {
+		query["verdict"] = filter.Verdict
+	}
+	createdAt := bson.M{}
+	if filter.Correct != nil {
+		query["correct"] = *filter.Correct
+		// Answers that can still be changed aren't revealed by filtering
+		createdAt["$lt"] = uc.now().Add(-UndoWindow)
+	}
+	if filter.Subreddit != "" {
+		query["subreddit"] = filter.Subreddit
+	}
+	if filter.Source != "" {
+		query["source"] = filter.Source
+	}
+	if filter.Tag != "" {
+		query["tags"] = filter.Tag
+	}
+	if !filter.From.IsZero() {
+		createdAt["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		if before, ok := createdAt["$lt"].(time.Time); !ok || filter.To.Before(before) {
+			createdAt["$lt"] = filter.To
+		}
+	}
+	if len(createdAt) > 0 {
+		query["created_at"] = createdAt
+	}
+
+	total, err := uc.judgments.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64(filter.Offset)).
+		SetLimit(int64(filter.Limit))
+	cursor, err := uc.judgments.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	judgments := []Judgment{}
+	if err := cursor.All(ctx, &judgments); err != nil {
+		return nil, 0, err
+	}
+	now := uc.now()
+	for i := range judgments {
+		judgments[i] = judgments[i].forResponse(now)
+	}
+	return judgments, total, nil
+}
+
+// GetHistory returns the authenticated user's judgments, paginated with
+// limit/offset and filtered by verdict, correct, subreddit, source, tag and
+// a from/to date range (YYYY-MM-DD, to is inclusive). Undone judgments are
+// left out unless include_undone=true.
+func (uc *UserController) GetHistory(c *gin.Context) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+		return
+	}
+
+	filter := JudgmentFilter{
+		Verdict:   c.Query("verdict"),
+		Subreddit: c.Query("subreddit"),
+		Source:    c.Query("source"),
+		Tag:       c.Query("tag"),
+		Limit:     limit,
+		Offset:    offset,
+
+		IncludeUndone: c.Query("include_undone") == "true",
+	}
+	if value := c.Query("correct"); value != "" {
+		correct, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "correct must be true or false"})
+			return
+		}
+		filter.Correct = &correct
+	}
+	if value := c.Query("from"); value != "" {
+		if filter.From, err = time.Parse("2006-01-02", value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date (YYYY-MM-DD)"})
+			return
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		to, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date (YYYY-MM-DD)"})
+			return
+		}
+		filter.To = to.AddDate(0, 0, 1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	judgments, total, err := uc.ListJudgments(ctx, username, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch history", "details": err.Error()})
+		return
+	}
+	if err := uc.withholdJudgments(ctx, judgments); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check posts in play", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+		"count":   len(judgments),
+		"results": judgments,
+	})
+}
+
+// MigratePostHistory copies every user's legacy post_history map into the
+// judgments collection and recalculates their stats from the result.
+// Judgments that are already stored are left alone, so it is safe to run
+// more than once.
+func (uc *UserController) MigratePostHistory(ctx context.Context) (int, error) {
+	cursor, err := uc.collection.Find(ctx,
+		bson.M{"post_history": bson.M{"$exists": true, "$ne": bson.M{}}},
+		options.Find().SetProjection(bson.M{"username": 1, "created_at": 1, "post_history": 1}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var user User
+		if err := cursor.Decode(&user); err != nil {
+			return migrated, err
+		}
+		count, err := uc.migrateUserHistory(ctx, user)
+		migrated += count
+		if err != nil {
+			return migrated, err
+		}
+		if _, err := uc.recalculateStats(ctx, user.Username); err != nil {
+			return migrated, err
+		}
+	}
+	return migrated, cursor.Err()
+}
+
+// migrateUserHistory stores judgments for any post_history entries that
+// don't have one. The original judgment times weren't recorded, so migrated
+// judgments are dated when the user signed up.
+func (uc *UserController) migrateUserHistory(ctx context.Context, user User) (int, error) {
+	migrated := 0
+	for postID, verdict := range user.PostHistory {
+		var post Post
+		err := uc.posts.FindOne(ctx, bson.M{"post_id": postID}).Decode(&post)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return migrated, err
+		}
+
+		judgment := Judgment{
+			Username:      user.Username,
+			PostID:        postID,
+			Verdict:       verdict,
+			ScoredVerdict: verdict,
+			Source:        SourceMigration,
+			CreatedAt:     user.CreatedAt,
+		}
+		judgment.applyPost(post)
+		judgment.Difficulty = post.DifficultyScore()
+
+		result, err := uc.judgments.UpdateOne(ctx,
+			bson.M{"username": user.Username, "post_id": postID},
+			bson.M{"$setOnInsert": judgment},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return migrated, fmt.Errorf("failed to migrate %s/%s: %w", user.Username, postID, err)
+		}
+		if result.UpsertedCount > 0 {
+			migrated++
+		}
+	}
+	return migrated, nil
+}
+
+// recalculateStats derives the user's post history, post count, accuracy,
+// category stats and XP from all of their judgments, so every stat agrees
+// with the same scored answers. Judgments on posts that have since been
+// catalogued or tagged are rescored first. It reads the user's whole history,
+// so it is for backfills; judging updates stats with applyJudgmentStats.
+func (uc *UserController) recalculateStats(ctx context.Context, username string) (*User, error) {
+	var user User
+	if err := uc.collection.FindOne(ctx, bson.M{"username": username}).Decode(&user); err != nil {
+		return nil, err
+	}
+
+	cursor, err := uc.judgments.Find(ctx, bson.M{"username": username, "undone_at": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, err
+	}
+	var judgments []Judgment
+	if err := cursor.All(ctx, &judgments); err != nil {
+		return nil, err
+	}
+
+	if err := uc.rescoreJudgments(ctx, judgments); err != nil {
+		return nil, err
+	}
+
+	history := make(map[string]string, len(judgments))
+	scored := make(map[string]string, len(judgments))
+	tags := make(map[string][]string, len(judgments))
+	verdicts := make(map[string]string, len(judgments))
+	scoredCount, correctCount := 0, 0
+	for _, judgment := range judgments {
+		history[judgment.PostID] = judgment.Verdict
+		scored[judgment.PostID] = judgment.ScoredVerdict
+		verdicts[judgment.PostID] = judgment.CommunityVerdict
+		if len(judgment.Tags) > 0 {
+			tags[judgment.PostID] = judgment.Tags
+		}
+		if judgment.Correct != nil {
+			scoredCount++
+			if *judgment.Correct {
+				correctCount++
+			}
+		}
+	}
+
+	user.PostHistory = history
+	user.NumPosts = len(history)
+	user.ScoredJudgments = scoredCount
+	user.CorrectJudgments = correctCount
+	user.HistoryTags = tags
+	user.CategoryStats = ComputeCategoryStats(scored, tags, verdicts)
+	user.FavCategory = FavouriteCategory(user.CategoryStats)
+	user.XP = TotalXP(judgments)
+	user.Level = LevelForXP(user.XP).Level
+
+	set := bson.M{
+		"post_history":   user.PostHistory,
+		"num_posts":      user.NumPosts,
+		"history_tags":   user.HistoryTags,
+		"category_stats": user.CategoryStats,
+		"fav_category":   user.FavCategory,
+		"xp":             user.XP,
+		"level":          user.Level,
+
+		"scored_judgments":  user.ScoredJudgments,
+		"correct_judgments": user.CorrectJudgments,
+	}
+	// Keep the client-reported accuracy until the server can score something
+	if scoredCount > 0 {
+		user.Accuracy = math.Round(float64(correctCount) / float64(scoredCount) * 100)
+		set["accuracy"] = user.Accuracy
+	}
+	for field, value := range user.leaderboardScores() {
+		set[field] = value
+	}
+
+	if _, err := uc.collection.UpdateOne(ctx, bson.M{"username": username}, bson.M{"$set": set}); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// applyJudgmentStats updates the user's post history, post count, accuracy,
+// category stats, XP and contrarian wins for one judgment changing from
+// before to after. before
+// is nil for a new judgment and after is nil when it is undone. Counters are
+// adjusted in place so concurrent judgments don't overwrite each other.
+func (uc *UserController) applyJudgmentStats(ctx context.Context, username string, before, after *Judgment) (*User, error) {
+	counts := map[string]int{}
+	tags := map[string]bool{}
+	tally := func(judgment *Judgment, sign int) {
+		if judgment == nil {
+			return
+		}
+		counts["num_posts"] += sign
+		counts["xp"] += sign * judgment.XP()
+		if judgment.ContrarianWin {
+			counts["contrarian_wins"] += sign
+		}
+		if judgment.Correct != nil {
+			counts["scored_judgments"] += sign
+			if *judgment.Correct {
+				counts["correct_judgments"] += sign
+			}
+		}
+		side := VerdictSide(judgment.CommunityVerdict)
+		for _, tag := range judgment.Tags {
+			tags[tag] = true
+			prefix := "category_stats." + tag + "."
+			counts[prefix+"judged"] += sign
+			if side != "" {
+				counts[prefix+"scored"] += sign
+				if side == judgment.ScoredVerdict {
+					counts[prefix+"correct"] += sign
+				}
+			}
+		}
+	}
+	tally(before, -1)
+	tally(after, 1)
+
+	inc := bson.M{}
+	for field, delta := range counts {
+		if delta != 0 {
+			inc[field] = delta
+		}
+	}
+	update := bson.M{}
+	if len(inc) > 0 {
+		update["$inc"] = inc
+	}
+
+	postID := ""
+	if after != nil {
+		postID = after.PostID
+	} else if before != nil {
+		postID = before.PostID
+	}
+	switch {
+	case after == nil:
+		update["$unset"] = bson.M{"post_history." + postID: "", "history_tags." + postID: ""}
+	case len(after.Tags) > 0:
+		update["$set"] = bson.M{"post_history." + postID: after.Verdict, "history_tags." + postID: after.Tags}
+	default:
+		update["$set"] = bson.M{"post_history." + postID: after.Verdict}
+		update["$unset"] = bson.M{"history_tags." + postID: ""}
+	}
+
+	var user User
+	err := uc.collection.FindOneAndUpdate(ctx,
+		bson.M{"username": username},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+
+	// Derived stats follow from the updated counters
+	set := bson.M{}
+	unset := bson.M{}
+	for tag := range tags {
+		category, ok := user.CategoryStats[tag]
+		if !ok {
+			continue
+		}
+		if category.Judged <= 0 {
+			delete(user.CategoryStats, tag)
+			unset["category_stats."+tag] = ""
+			continue
+		}
+		category.Accuracy = category.accuracy()
+		user.CategoryStats[tag] = category
+		set["category_stats."+tag+".accuracy"] = category.Accuracy
+	}
+	user.FavCategory = FavouriteCategory(user.CategoryStats)
+	user.Level = LevelForXP(user.XP).Level
+	set["fav_category"] = user.FavCategory
+	set["level"] = user.Level
+	// Keep the client-reported accuracy until the server can score something
+	if user.ScoredJudgments > 0 {
+		user.Accuracy = math.Round(float64(user.CorrectJudgments) / float64(user.ScoredJudgments) * 100)
+		set["accuracy"] = user.Accuracy
+	}
+	for field, value := range user.leaderboardScores() {
+		set[field] = value
+	}
+
+	update = bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	if _, err := uc.collection.UpdateOne(ctx, bson.M{"username": username}, update); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// rescoreJudgments fills in the community verdict and tags of judgments made
+// before the post was catalogued or tagged
+func (uc *UserController) rescoreJudgments(ctx context.Context, judgments []Judgment) error {
+	var ids []string
+	for _, judgment := range judgments {
+		if judgment.CommunityVerdict == "" || len(judgment.Tags) == 0 {
+			ids = append(ids, judgment.PostID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	cursor, err := uc.posts.Find(ctx,
+		bson.M{"post_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"post_id": 1, "subreddit": 1, "tags": 1, "community_verdict": 1}),
+	)
+	if err != nil {
+		return err
+	}
+	var posts []Post
+	if err := cursor.All(ctx, &posts); err != nil {
+		return err
+	}
+	postsByID := make(map[string]Post, len(posts))
+	for _, post := range posts {
+		postsByID[post.PostID] = post
+	}
+
+	for i := range judgments {
+		judgment := &judgments[i]
+		post, ok := postsByID[judgment.PostID]
+		if !ok || (post.CommunityVerdict == judgment.CommunityVerdict && len(post.Tags) == len(judgment.Tags)) {
+			continue
+		}
+
+		judgment.applyPost(post)
+		set := bson.M{
+			"subreddit":         judgment.Subreddit,
+			"tags":              judgment.Tags,
+			"community_verdict": judgment.CommunityVerdict,
+		}
+		if judgment.Correct != nil {
+			set["correct"] = *judgment.Correct
+		}
+		if _, err := uc.judgments.UpdateOne(ctx, bson.M{"_id": judgment.ID}, bson.M{"$set": set}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecountVerdicts recounts the comment verdicts of every catalogued post.
+// When a post's community verdict changes, the judgments on it are rescored,
+// its difficulty is recomputed and the stats of everyone who judged it are
+// recalculated. It returns how many posts changed verdict.
+func (uc *UserController) RecountVerdicts(ctx context.Context) (int, error) {
+	cursor, err := uc.posts.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"post_id": 1, "comments": 1, "community_verdict": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	changed := 0
+	judged := make(map[string]bool)
+	for cursor.Next(ctx) {
+		var post Post
+		if err := cursor.Decode(&post); err != nil {
+			return changed, err
+		}
+		counts := CountVerdicts(post.Comments)
+		verdict := CommunityVerdict(counts)
+		_, err := uc.posts.UpdateOne(ctx,
+			bson.M{"post_id": post.PostID},
+			bson.M{"$set": bson.M{"verdict_counts": counts, "community_verdict": verdict}},
+		)
+		if err != nil {
+			return changed, err
+		}
+		if verdict == post.CommunityVerdict {
+			continue
+		}
+
+		usernames, err := uc.rescorePostJudgments(ctx, post.PostID, verdict)
+		if err != nil {
+			return changed, err
+		}
+		for _, username := range usernames {
+			judged[username] = true
+		}
+		if err := refreshDifficulty(ctx, uc.posts, uc.judgments, post.PostID); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	if err := cursor.Err(); err != nil {
+		return changed, err
+	}
+
+	for username := range judged {
+		if _, err := uc.recalculateStats(ctx, username); err != nil {
+			return changed, fmt.Errorf("failed to recalculate stats for %s: %w", username, err)
+		}
+	}
+	return changed, nil
+}
+
+// rescorePostJudgments scores every judgment on a post against a new
+// community verdict and returns who made them
+func (uc *UserController) rescorePostJudgments(ctx context.Context, postID, verdict string) ([]string, error) {
+	cursor, err := uc.judgments.Find(ctx, bson.M{"post_id": postID, "undone_at": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, err
+	}
+	var judgments []Judgment
+	if err := cursor.All(ctx, &judgments); err != nil {
+		return nil, err
+	}
+
+	usernames := make([]string, 0, len(judgments))
+	for _, judgment := range judgments {
+		judgment.CommunityVerdict = verdict
+		judgment.Correct = nil
+		judgment.score()
+
+		set := bson.M{"community_verdict": verdict}
+		update := bson.M{"$set": set}
+		if judgment.Correct != nil {
+			set["correct"] = *judgment.Correct
+		} else {
+			update["$unset"] = bson.M{"correct": ""}
+		}
+		if _, err := uc.judgments.UpdateOne(ctx, bson.M{"_id": judgment.ID}, update); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, judgment.Username)
+	}
+	return usernames, nil
+}
+
+// ChangeJudgment switches the verdict on a judged post. Within the undo
+// window the new verdict is the one that gets scored; afterwards the change
+// is recorded but the first committed answer still counts.
+func (uc *UserController) ChangeJudgment(c *gin.Context) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		Verdict string `json:"verdict" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+	if req.Verdict != VerdictYTA && req.Verdict != VerdictNTA {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verdict must be either 'YTA' or 'NTA'"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var judgment Judgment
+	err := uc.judgments.FindOne(ctx, bson.M{"username": username, "post_id": c.Param("postId"), "undone_at": bson.M{"$exists": false}}).Decode(&judgment)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Judgment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find judgment", "details": err.Error()})
+		return
+	}
+
+	updated, err := uc.changeJudgment(ctx, &judgment, req.Verdict)
+	if errors.Is(err, ErrJudgmentUnchanged) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verdict is unchanged"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change judgment", "details": err.Error()})
+		return
+	}
+
+	user, err := uc.applyJudgmentStats(ctx, username, &judgment, updated)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stats", "details": err.Error()})
+		return
+	}
+	if updated.Revisions[len(updated.Revisions)-1].Scored {
+		if err := refreshDifficulty(ctx, uc.posts, uc.judgments, updated.PostID); err != nil {
+			fmt.Println("Failed to update post difficulty:", err)
+		}
+		if err := uc.rateJudgment(ctx, user, updated); err != nil {
+			fmt.Println("Failed to update rating:", err)
+		}
+	}
+
+	shown := []Judgment{updated.forResponse(uc.now())}
+	if err := uc.withholdJudgments(ctx, shown); err != nil {
+		fmt.Println("Failed to check posts in play:", err)
+		shown[0] = shown[0].hideAnswer()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Judgment changed",
+		"judgment":  shown[0],
+		"scored":    updated.Revisions[len(updated.Revisions)-1].Scored,
+		"num_posts": user.NumPosts,
+		"accuracy":  user.Accuracy,
+	})
+}
+
+// UndoJudgment withdraws a judgment made within the undo window, as if the
+// post had never been judged
+func (uc *UserController) UndoJudgment(c *gin.Context) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	judgment, err := uc.undoJudgment(ctx, username, c.Param("postId"))
+	switch {
+	case errors.Is(err, ErrJudgmentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Judgment not found"})
+		return
+	case errors.Is(err, ErrUndoWindowExpired):
+		c.JSON(http.StatusConflict, gin.H{"error": "Undo window has expired, change the verdict instead"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to undo judgment", "details": err.Error()})
+		return
+	}
+
+	if err := uc.undoActivity(ctx, username, judgment.CreatedAt); err != nil {
+		fmt.Println("Failed to update activity after undo:", err)
+	}
+	if err := refreshDifficulty(ctx, uc.posts, uc.judgments, judgment.PostID); err != nil {
+		fmt.Println("Failed to update post difficulty:", err)
+	}
+	if err := uc.unrateJudgment(ctx, username, judgment); err != nil {
+		fmt.Println("Failed to update rating after undo:", err)
+	}
+
+	user, err := uc.applyJudgmentStats(ctx, username, judgment, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stats", "details": err.Error()})
+		return
+	}
+
+	shown := []Judgment{judgment.forResponse(uc.now())}
+	if err := uc.withholdJudgments(ctx, shown); err != nil {
+		fmt.Println("Failed to check posts in play:", err)
+		shown[0] = shown[0].hideAnswer()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Judgment undone",
+		"judgment":     shown[0],
+		"num_posts":    user.NumPosts,
+		"accuracy":     user.Accuracy,
+		"streak_count": user.StreakCount,
+	})
+}
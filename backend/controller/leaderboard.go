@@ -0,0 +1,673 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Leaderboard paging
+const (
+	DefaultLeaderboardLimit = 50
+	MaxLeaderboardLimit     = 100
+	LeaderboardNeighbours   = 2  // Players shown either side of the requesting user
+	LeaderboardWinners      = 3  // Players archived for each finished period
+	IneligibleLimit         = 20 // Ineligible players listed on the accuracy leaderboard
+
+	LeaderboardArchiveInterval = 10 * time.Minute // How often the server archives finished periods
+)
+
+// Leaderboard periods. Periods other than all-time are counted from judgment
+// times and roll over at midnight UTC; weeks start on Monday.
+const (
+	PeriodDaily   = "daily"
+	PeriodWeekly  = "weekly"
+	PeriodMonthly = "monthly"
+	PeriodAllTime = "alltime"
+)
+
+// LeaderboardPeriods are the available periods
+var LeaderboardPeriods = []string{PeriodDaily, PeriodWeekly, PeriodMonthly, PeriodAllTime}
+
+// LeaderboardEntry is one ranked player
+type LeaderboardEntry struct {
+	ID       primitive.ObjectID `json:"_id" bson:"_id"`
+	Username string             `json:"username" bson:"username"`
+	Name     string             `json:"name" bson:"name"`
+	PFP      string             `json:"pfp" bson:"pfp"`
+	NumPosts int                `json:"num_posts" bson:"num_posts"`
+	Accuracy float64            `json:"accuracy" bson:"accuracy"`
+	Rating   *Rating            `json:"rating,omitempty" bson:"rating,omitempty"`
+	Score    float64            `json:"score" bson:"score"` // The value being ranked by
+	Rank     int                `json:"rank" bson:"rank"`
+
+	// Eligibility, on leaderboards that have rules
+	Scored    int              `json:"scored,omitempty" bson:"scored,omitempty"`
+	CreatedAt time.Time        `json:"-" bson:"created_at,omitempty"`
+	Missing   []EligibilityGap `json:"missing,omitempty" bson:"-"`
+}
+
+// LeaderboardArchive records the winners of a finished period
+type LeaderboardArchive struct {
+	Period     string             `json:"period" bson:"period"`
+	Sort       string             `json:"sort" bson:"sort"`
+	Start      time.Time          `json:"start" bson:"start"`
+	End        time.Time          `json:"end" bson:"end"`
+	Winners    []LeaderboardEntry `json:"winners" bson:"winners"`
+	ArchivedAt time.Time          `json:"archived_at" bson:"archived_at"`
+}
+
+// leaderboardSort is a way of ranking players. Lifetime leaderboards sort on
+// a field stored on the player documents, which is indexed with the
+// username. Period leaderboards sort on the same field of the period's
+// totals, or on a score computed from them.
+type leaderboardSort struct {
+	field       string
+	score       bson.M // Computes the value from a period's totals, if it isn't one of them
+	windowed    bool   // Whether it can be ranked over a period
+	eligibility bool   // Whether players must meet the eligibility rules
+}
+
+// overallScore is OverallScore as an aggregation expression over the
+// accuracy and num_posts fields
+var overallScore = bson.M{"$add": bson.A{
+	bson.M{"$multiply": bson.A{bson.M{"$ifNull": bson.A{"$accuracy", 0}}, 0.7}},
+	bson.M{"$divide": bson.A{bson.M{"$multiply": bson.A{bson.M{"$ifNull": bson.A{"$num_posts", 0}}, 0.3}}, 5}},
+}}
+
+// leaderboardSorts are the available sort options
+var leaderboardSorts = map[string]leaderboardSort{
+	"num_posts": {field: "num_posts", windowed: true},
+	// Wilson lower bound of accuracy, among players who have judged enough
+	"accuracy": {field: "accuracy_score", score: wilsonScore, windowed: true, eligibility: true},
+	// Skill rating, discounted by how uncertain it still is
+	"rating": {field: "conservative_rating"},
+	// A weighted combination of accuracy and posts (70% accuracy, 30% posts)
+	"overall": {field: "overall_score", score: overallScore, windowed: true},
+}
+
+// OverallScore weighs a player's accuracy at 70% and their post count at 30%
+func OverallScore(accuracy float64, numPosts int) float64 {
+	return accuracy*0.7 + float64(numPosts)*0.3/5
+}
+
+// leaderboardScores returns the stored fields lifetime leaderboards sort on
+func (u *User) leaderboardScores() bson.M {
+	u.OverallScore = OverallScore(u.Accuracy, u.NumPosts)
+	u.AccuracyScore = WilsonLowerBound(u.CorrectJudgments, u.ScoredJudgments)
+	u.ConservativeRating = u.rating().Conservative()
+	return bson.M{
+		"overall_score":       u.OverallScore,
+		"accuracy_score":      u.AccuracyScore,
+		"conservative_rating": u.ConservativeRating,
+	}
+}
+
+// PeriodBounds returns the start and end of the period containing t. The
+// all-time period has zero bounds.
+func PeriodBounds(period string, t time.Time) (time.Time, time.Time) {
+	year, month, day := t.UTC().Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	switch period {
+	case PeriodDaily:
+		return today, today.AddDate(0, 0, 1)
+	case PeriodWeekly:
+		// Go's weeks start on Sunday
+		start := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+		return start, start.AddDate(0, 0, 7)
+	case PeriodMonthly:
+		start := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	default:
+		return time.Time{}, time.Time{}
+	}
+}
+
+// leaderboardQuery ranks players from a collection
+type leaderboardQuery struct {
+	collection *mongo.Collection
+	players    mongo.Pipeline // Stages producing one document per player
+	details    mongo.Pipeline // Stages adding display fields to a page of players
+	sort       leaderboardSort
+	lifetime   bool   // Whether players are ranked by their stored fields
+	match      bson.M // Which players are ranked, after scoring
+	eligible   bson.M // Which players meet the eligibility rules, if any
+
+	eligibility *EligibilityRules // Rules players are checked against, if any
+	at          time.Time         // When eligibility is checked
+}
+
+// leaderboard returns the query ranking players by sort over the period
+// containing t
+func (uc *UserController) leaderboard(sort leaderboardSort, period string, t time.Time) leaderboardQuery {
+	now := uc.now()
+	if period == PeriodAllTime {
+		q := uc.allTimeLeaderboard(sort)
+		if sort.eligibility {
+			q = uc.withEligibility(q, true, now)
+		}
+		return q
+	}
+
+	start, end := PeriodBounds(period, t)
+	q := uc.periodLeaderboard(sort, start, end)
+	if sort.eligibility {
+		// Finished periods are judged by the rules as they stood at the end
+		q = uc.withEligibility(q, false, minTime(now, end))
+	}
+	return q
+}
+
+// minTime returns the earlier of two times
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// allTimeLeaderboard ranks players by their lifetime stats
+func (uc *UserController) allTimeLeaderboard(sort leaderboardSort) leaderboardQuery {
+	return leaderboardQuery{
+		collection: uc.collection,
+		sort:       sort,
+		lifetime:   true,
+		details: mongo.Pipeline{
+			{{Key: "$addFields", Value: bson.M{"scored": bson.M{"$ifNull": bson.A{"$scored_judgments", 0}}}}},
+		},
+	}
+}
+
+// periodLeaderboard ranks players by the judgments they made between start
+// and end. Migrated judgments don't count because their real dates weren't
+// recorded.
+func (uc *UserController) periodLeaderboard(sort leaderboardSort, start, end time.Time) leaderboardQuery {
+	return leaderboardQuery{
+		collection: uc.judgments,
+		sort:       sort,
+		players: mongo.Pipeline{
+			{{Key: "$match", Value: bson.M{
+				"created_at": bson.M{"$gte": start, "$lt": end},
+				"undone_at":  bson.M{"$exists": false},
+				"source":     bson.M{"$ne": SourceMigration},
+			}}},
+			{{Key: "$group", Value: bson.M{
+				"_id":       "$username",
+				"num_posts": bson.M{"$sum": 1},
+				"scored":    bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{bson.M{"$type": "$correct"}, "bool"}}, 1, 0}}},
+				"correct":   bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$correct", true}}, 1, 0}}},
+			}}},
+			{{Key: "$addFields", Value: bson.M{
+				"username": "$_id",
+				"accuracy": bson.M{"$cond": bson.A{
+					bson.M{"$gt": bson.A{"$scored", 0}},
+					bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{bson.M{"$divide": bson.A{"$correct", "$scored"}}, 100}}, 1}},
+					0,
+				}},
+			}}},
+		},
+		details: mongo.Pipeline{
+			{{Key: "$lookup", Value: bson.M{"from": uc.collection.Name(), "localField": "username", "foreignField": "username", "as": "user"}}},
+			{{Key: "$unwind", Value: "$user"}},
+			{{Key: "$addFields", Value: bson.M{
+				"_id":    "$user._id",
+				"name":   "$user.name",
+				"pfp":    "$user.pfp",
+				"rating": "$user.rating",
+			}}},
+		},
+	}
+}
+
+// key returns the field the leaderboard is sorted on
+func (q leaderboardQuery) key() string {
+	if q.lifetime || q.sort.score == nil {
+		return q.sort.field
+	}
+	return "score"
+}
+
+// scored returns the player stages followed by any extra stages given,
+// adding the computed score if the sort needs one
+func (q leaderboardQuery) scored(stages ...bson.D) mongo.Pipeline {
+	pipeline := append(mongo.Pipeline{}, q.players...)
+	if q.key() == "score" {
+		pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: bson.M{"score": q.sort.score}}})
+	}
+	if q.match != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: q.match}})
+	}
+	return append(pipeline, stages...)
+}
+
+// page returns players ranked skip+1 onwards
+func (q leaderboardQuery) page(ctx context.Context, skip, limit int) ([]LeaderboardEntry, error) {
+	pipeline := q.scored(
+		bson.D{{Key: "$sort", Value: bson.D{{Key: q.key(), Value: -1}, {Key: "username", Value: 1}}}},
+		bson.D{{Key: "$skip", Value: skip}},
+		bson.D{{Key: "$limit", Value: limit}},
+	)
+	pipeline = append(pipeline, q.details...)
+	pipeline = append(pipeline, bson.D{{Key: "$project", Value: bson.M{
+		"username":   1,
+		"name":       1,
+		"num_posts":  1,
+		"accuracy":   1,
+		"pfp":        1,
+		"rating":     1,
+		"scored":     1,
+		"created_at": 1,
+		"score":      bson.M{"$ifNull": bson.A{"$" + q.key(), 0}},
+	}}})
+
+	cursor, err := q.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	entries := []LeaderboardEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		entries[i].Rank = skip + i + 1
+	}
+	q.annotate(entries)
+	return entries, nil
+}
+
+// count returns how many players match the extra stages, or all of them
+func (q leaderboardQuery) count(ctx context.Context, stages ...bson.D) (int, error) {
+	cursor, err := q.collection.Aggregate(ctx, q.scored(append(stages, bson.D{{Key: "$count", Value: "players"}})...))
+	if err != nil {
+		return 0, err
+	}
+	var counts []struct {
+		Players int `bson:"players"`
+	}
+	if err := cursor.All(ctx, &counts); err != nil || len(counts) == 0 {
+		return 0, err
+	}
+	return counts[0].Players, nil
+}
+
+// rank returns the user's position on the leaderboard, or 0 if they aren't
+// on it
+func (q leaderboardQuery) rank(ctx context.Context, username string) (int, error) {
+	cursor, err := q.collection.Aggregate(ctx, q.scored(bson.D{{Key: "$match", Value: bson.M{"username": username}}}))
+	if err != nil {
+		return 0, err
+	}
+	var found []bson.M
+	if err := cursor.All(ctx, &found); err != nil || len(found) == 0 {
+		return 0, err
+	}
+
+	// Everyone with a higher value, or the same value and an earlier username, ranks above
+	value := found[0][q.key()]
+	if value == nil {
+		value = 0
+	}
+	above, err := q.count(ctx, bson.D{{Key: "$match", Value: bson.M{"$or": bson.A{
+		bson.M{q.key(): bson.M{"$gt": value}},
+		bson.M{q.key(): value, "username": bson.M{"$lt": username}},
+	}}}})
+	if err != nil {
+		return 0, err
+	}
+	return above + 1, nil
+}
+
+// createLeaderboardIndexes supports sorting by the stored fields, with the
+// username as a tiebreaker so ranks are stable, and one archive per period.
+// Players saved before the scores were stored have them filled in.
+func (uc *UserController) createLeaderboardIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var models []mongo.IndexModel
+	for _, sort := range leaderboardSorts {
+		models = append(models, mongo.IndexModel{Keys: bson.D{{Key: sort.field, Value: -1}, {Key: "username", Value: 1}}})
+	}
+	if _, err := uc.collection.Indexes().CreateMany(ctx, models); err != nil {
+		fmt.Println("Failed to create leaderboard indexes:", err)
+	}
+
+	_, err := uc.collection.UpdateMany(ctx,
+		bson.M{"overall_score": bson.M{"$exists": false}},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{
+				"scored":  bson.M{"$ifNull": bson.A{"$scored_judgments", 0}},
+				"correct": bson.M{"$ifNull": bson.A{"$correct_judgments", 0}},
+			}}},
+			{{Key: "$set", Value: bson.M{
+				"overall_score":  overallScore,
+				"accuracy_score": wilsonScore,
+				"conservative_rating": bson.M{"$subtract": bson.A{
+					bson.M{"$ifNull": bson.A{"$rating.rating", DefaultRating}},
+					bson.M{"$multiply": bson.A{2, bson.M{"$ifNull": bson.A{"$rating.deviation", DefaultRatingDeviation}}}},
+				}},
+			}}},
+			{{Key: "$unset", Value: bson.A{"scored", "correct"}}},
+		},
+	)
+	if err != nil {
+		fmt.Println("Failed to fill in leaderboard scores:", err)
+	}
+
+	_, err = uc.judgments.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "created_at", Value: 1}},
+	})
+	if err != nil {
+		fmt.Println("Failed to create judgments created_at index:", err)
+	}
+
+	_, err = uc.leaderboardArchive.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "period", Value: 1}, {Key: "sort", Value: 1}, {Key: "start", Value: -1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		fmt.Println("Failed to create leaderboard archive index:", err)
+	}
+}
+
+// archiveFinishedPeriods records the winners of every finished period that
+// hasn't been archived yet, oldest first, and returns how many it archived
+func (uc *UserController) archiveFinishedPeriods(ctx context.Context, period string, now time.Time) (int, error) {
+	current, _ := PeriodBounds(period, now)
+	archived := 0
+	for sortBy, sort := range leaderboardSorts {
+		if !sort.windowed {
+			continue
+		}
+		next, err := uc.firstUnarchived(ctx, period, sortBy)
+		if err != nil {
+			return archived, err
+		}
+
+		for !next.IsZero() && next.Before(current) {
+			start, end := PeriodBounds(period, next)
+			winners, err := uc.leaderboard(sort, period, start).page(ctx, 0, LeaderboardWinners)
+			if err != nil {
+				return archived, err
+			}
+			filter := bson.M{"period": period, "sort": sortBy, "start": start}
+			archive := LeaderboardArchive{Period: period, Sort: sortBy, Start: start, End: end, Winners: winners, ArchivedAt: now}
+			_, err = uc.leaderboardArchive.UpdateOne(ctx, filter, bson.M{"$setOnInsert": archive}, options.Update().SetUpsert(true))
+			if err != nil && !mongo.IsDuplicateKeyError(err) {
+				return archived, err
+			}
+			archived++
+			next = end
+		}
+	}
+	return archived, nil
+}
+
+// firstUnarchived returns the start of the first period after the latest
+// archived one. With nothing archived yet it is the period of the first
+// judgment that counts on period leaderboards, and zero if there are none.
+func (uc *UserController) firstUnarchived(ctx context.Context, period, sortBy string) (time.Time, error) {
+	var latest LeaderboardArchive
+	err := uc.leaderboardArchive.FindOne(ctx,
+		bson.M{"period": period, "sort": sortBy},
+		options.FindOne().SetSort(bson.D{{Key: "start", Value: -1}}),
+	).Decode(&latest)
+	if err == nil {
+		return latest.End, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return time.Time{}, err
+	}
+
+	var first Judgment
+	err = uc.judgments.FindOne(ctx,
+		bson.M{"undone_at": bson.M{"$exists": false}, "source": bson.M{"$ne": SourceMigration}},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetProjection(bson.M{"created_at": 1}),
+	).Decode(&first)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	start, _ := PeriodBounds(period, first.CreatedAt)
+	return start, nil
+}
+
+// ArchiveLeaderboards records the winners of every finished period that
+// hasn't been archived, for all periods, and returns how many it archived
+func (uc *UserController) ArchiveLeaderboards(ctx context.Context) (int, error) {
+	archived := 0
+	for _, period := range LeaderboardPeriods {
+		if period == PeriodAllTime {
+			continue
+		}
+		count, err := uc.archiveFinishedPeriods(ctx, period, uc.now())
+		archived += count
+		if err != nil {
+			return archived, err
+		}
+	}
+	return archived, nil
+}
+
+// ArchiveLeaderboardsEvery archives finished leaderboard periods in the
+// background, straight away and then at every interval, so requests never
+// have to
+func (uc *UserController) ArchiveLeaderboardsEvery(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			if _, err := uc.ArchiveLeaderboards(ctx); err != nil {
+				fmt.Println("Failed to archive leaderboard winners:", err)
+			}
+			cancel()
+			<-ticker.C
+		}
+	}()
+}
+
+// parseLeaderboardQuery reads the sort and period query parameters
+func (uc *UserController) parseLeaderboardQuery(c *gin.Context) (leaderboardQuery, string, string, error) {
+	// Get the sort criteria from query parameter
+	sortBy := c.DefaultQuery("sort", "overall")
+	sort, ok := leaderboardSorts[sortBy]
+	if !ok {
+		// Keep the old behaviour of treating anything unknown as overall
+		sortBy = "overall"
+		sort = leaderboardSorts[sortBy]
+	}
+
+	period := c.DefaultQuery("period", PeriodAllTime)
+	if !slices.Contains(LeaderboardPeriods, period) {
+		return leaderboardQuery{}, "", "", fmt.Errorf("period must be one of daily, weekly, monthly or alltime")
+	}
+	if period != PeriodAllTime && !sort.windowed {
+		return leaderboardQuery{}, "", "", fmt.Errorf("sort=%s is only available for the alltime period", sortBy)
+	}
+	return uc.leaderboard(sort, period, uc.now()), sortBy, period, nil
+}
+
+// GetLeaderboard retrieves a page of user rankings sorted by the specified
+// criteria over a period, along with the requesting user's own rank and the
+// players either side of them
+func (uc *UserController) GetLeaderboard(c *gin.Context) {
+	query, sortBy, period, err := uc.parseLeaderboardQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(DefaultLeaderboardLimit)))
+	if err != nil || limit < 1 || limit > MaxLeaderboardLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", MaxLeaderboardLimit)})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+		return
+	}
+
+	// Create context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Friends leaderboards rank the user against the people they're friends with
+	scope := c.DefaultQuery("scope", ScopeGlobal)
+	switch scope {
+	case ScopeGlobal:
+	case ScopeFriends:
+		username := c.GetString("username")
+		friends, err := uc.friends(ctx, username)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch friends", "details": err.Error()})
+			return
+		}
+		query = query.among(append(friends, username))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be global or friends"})
+		return
+	}
+
+	response := gin.H{
+		"sort":   sortBy,
+		"period": period,
+		"scope":  scope,
+		"limit":  limit,
+		"offset": offset,
+	}
+	if period != PeriodAllTime {
+		start, end := PeriodBounds(period, uc.now())
+		response["start"] = start
+		response["end"] = end
+	}
+
+	results, err := query.page(ctx, offset, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users", "details": err.Error()})
+		return
+	}
+	total, err := query.count(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count users", "details": err.Error()})
+		return
+	}
+	response["results"] = results
+	response["total"] = total
+
+	// The requesting user's own position, even when it's off this page
+	username := c.GetString("username")
+	rank, err := query.rank(ctx, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find your rank", "details": err.Error()})
+		return
+	}
+	if rank > 0 {
+		skip := max(rank-1-LeaderboardNeighbours, 0)
+		neighbours, err := query.page(ctx, skip, rank-skip+LeaderboardNeighbours)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve neighbours", "details": err.Error()})
+			return
+		}
+		response["rank"] = rank
+		response["neighbours"] = neighbours
+		for _, entry := range neighbours {
+			if entry.Username == username {
+				response["me"] = entry
+			}
+		}
+	}
+
+	// Show who isn't ranked yet and what they're missing
+	if query.eligibility != nil {
+		ineligible := query.ineligible()
+		players, err := ineligible.page(ctx, 0, IneligibleLimit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve ineligible users", "details": err.Error()})
+			return
+		}
+		count, err := ineligible.count(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count ineligible users", "details": err.Error()})
+			return
+		}
+		response["eligibility"] = gin.H{
+			"min_judgments":    query.eligibility.MinJudgments,
+			"min_account_days": int(query.eligibility.MinAccountAge.Hours() / 24),
+		}
+		response["ineligible"] = players
+		response["ineligible_total"] = count
+
+		if rank == 0 {
+			position, err := ineligible.rank(ctx, username)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find your rank", "details": err.Error()})
+				return
+			}
+			if position > 0 {
+				if me, err := ineligible.page(ctx, position-1, 1); err == nil && len(me) == 1 {
+					me[0].Rank = 0
+					response["me"] = me[0]
+				}
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetLeaderboardWinners lists the archived winners of past periods, newest first
+func (uc *UserController) GetLeaderboardWinners(c *gin.Context) {
+	period := c.DefaultQuery("period", PeriodWeekly)
+	if period == PeriodAllTime || !slices.Contains(LeaderboardPeriods, period) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period must be one of daily, weekly or monthly"})
+		return
+	}
+	sortBy := c.DefaultQuery("sort", "overall")
+	if sort, ok := leaderboardSorts[sortBy]; !ok || !sort.windowed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be one of overall, accuracy or num_posts"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > MaxLeaderboardLimit {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", MaxLeaderboardLimit)})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Periods nobody played in are archived without winners
+	cursor, err := uc.leaderboardArchive.Find(ctx,
+		bson.M{"period": period, "sort": sortBy, "winners.0": bson.M{"$exists": true}},
+		options.Find().SetSort(bson.D{{Key: "start", Value: -1}}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve winners", "details": err.Error()})
+		return
+	}
+	archives := []LeaderboardArchive{}
+	if err := cursor.All(ctx, &archives); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode winners", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"period":  period,
+		"sort":    sortBy,
+		"results": archives,
+	})
+}
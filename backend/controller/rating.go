@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Glicko-2 settings. Each scored judgment is a game between the player and
+// the post, and each day is a rating period: a player's deviation grows for
+// every day they don't play.
+const (
+	DefaultRating          = 1500.0
+	DefaultRatingDeviation = 350.0
+	DefaultVolatility      = 0.06
+	PostRatingDeviation    = 60.0 // Posts are rated from many answers, so they're treated as fairly certain
+	GlickoTau              = 0.5  // How much volatility can change
+
+	glickoScale     = 173.7178 // Converts between the Glicko and Glicko-2 scales
+	glickoTolerance = 0.000001
+)
+
+// Rating is a Glicko-2 skill rating
+type Rating struct {
+	Rating     float64   `json:"rating" bson:"rating"`
+	Deviation  float64   `json:"deviation" bson:"deviation"` // Uncertainty, shrinking as the player judges more posts
+	Volatility float64   `json:"volatility" bson:"volatility"`
+	RatedAt    time.Time `json:"rated_at" bson:"rated_at"`
+}
+
+// RatingChange records a judgment's effect on the player's rating so it can
+// be taken back if the judgment is undone
+type RatingChange struct {
+	Before Rating `json:"before" bson:"before"`
+	After  Rating `json:"after" bson:"after"`
+}
+
+// NewRating returns the rating every player starts with
+func NewRating() Rating {
+	return Rating{Rating: DefaultRating, Deviation: DefaultRatingDeviation, Volatility: DefaultVolatility}
+}
+
+// Conservative returns the rating the player is very likely to be at least
+// as good as. Leaderboards rank by this so a few lucky answers don't win.
+func (r Rating) Conservative() float64 {
+	return r.Rating - 2*r.Deviation
+}
+
+// same reports whether two ratings are the same state
+func (r Rating) same(other Rating) bool {
+	return r.Rating == other.Rating && r.Deviation == other.Deviation &&
+		r.Volatility == other.Volatility && r.RatedAt.Equal(other.RatedAt)
+}
+
+// PostRating returns a post's rating as an opponent. A post an average
+// player gets wrong half the time is rated 1500; easier posts rate lower.
+func PostRating(difficulty float64) Rating {
+	d := math.Max(0.01, math.Min(0.99, difficulty))
+	return Rating{
+		Rating:     DefaultRating + glickoScale*math.Log(d/(1-d)),
+		Deviation:  PostRatingDeviation,
+		Volatility: DefaultVolatility,
+	}
+}
+
+// ratingGame is one result in a rating period, where score is 1 for a win
+// and 0 for a loss
+type ratingGame struct {
+	opponent Rating
+	score    float64
+}
+
+// UpdateRating returns the player's rating after one game at now against
+// opponent, where score is 1 for a win and 0 for a loss
+func UpdateRating(player, opponent Rating, score float64, now time.Time) Rating {
+	return ratePeriod(player, []ratingGame{{opponent: opponent, score: score}}, now)
+}
+
+// ratePeriod returns the player's rating after a rating period at now in
+// which they played games
+func ratePeriod(player Rating, games []ratingGame, now time.Time) Rating {
+	// Step 1: every full day since the last game is an empty rating period
+	phi := player.Deviation / glickoScale
+	sigma := player.Volatility
+	if !player.RatedAt.IsZero() {
+		for idle := daysBetween(player.RatedAt, now) - 1; idle > 0; idle-- {
+			phi = math.Min(math.Sqrt(phi*phi+sigma*sigma), DefaultRatingDeviation/glickoScale)
+		}
+	}
+
+	// Step 2: convert to the Glicko-2 scale
+	mu := (player.Rating - DefaultRating) / glickoScale
+
+	// Steps 3 and 4: estimated variance and improvement
+	information, improvement := 0.0, 0.0
+	for _, game := range games {
+		muJ := (game.opponent.Rating - DefaultRating) / glickoScale
+		phiJ := game.opponent.Deviation / glickoScale
+		g := 1 / math.Sqrt(1+3*phiJ*phiJ/(math.Pi*math.Pi))
+		expected := 1 / (1 + math.Exp(-g*(mu-muJ)))
+		information += g * g * expected * (1 - expected)
+		improvement += g * (game.score - expected)
+	}
+	v := 1 / information
+	delta := v * improvement
+
+	// Step 5: new volatility, by the Illinois algorithm
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		return ex*(delta*delta-phi*phi-v-ex)/(2*math.Pow(phi*phi+v+ex, 2)) - (x-a)/(GlickoTau*GlickoTau)
+	}
+	lower := a
+	var upper float64
+	if delta*delta > phi*phi+v {
+		upper = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*GlickoTau) < 0 {
+			k++
+		}
+		upper = a - k*GlickoTau
+	}
+	fLower, fUpper := f(lower), f(upper)
+	for math.Abs(upper-lower) > glickoTolerance {
+		next := lower + (lower-upper)*fLower/(fUpper-fLower)
+		fNext := f(next)
+		if fNext*fUpper <= 0 {
+			lower, fLower = upper, fUpper
+		} else {
+			fLower /= 2
+		}
+		upper, fUpper = next, fNext
+	}
+	sigma = math.Exp(lower / 2)
+
+	// Steps 6 and 7: new deviation and rating
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	mu += phi * phi * improvement
+
+	// Step 8: back to the Glicko scale
+	return Rating{
+		Rating:     mu*glickoScale + DefaultRating,
+		Deviation:  math.Min(phi*glickoScale, DefaultRatingDeviation),
+		Volatility: sigma,
+		RatedAt:    now,
+	}
+}
+
+// rating returns the user's stored rating, or the starting one
+func (u *User) rating() Rating {
+	if u.Rating == nil {
+		return NewRating()
+	}
+	return *u.Rating
+}
+
+// rateJudgment updates the user's rating with a scored judgment. Rating a
+// judgment again, e.g. after changing the answer inside the undo window,
+// replaces its earlier effect as long as nothing has been rated since.
+func (uc *UserController) rateJudgment(ctx context.Context, user *User, judgment *Judgment) error {
+	if judgment.Correct == nil {
+		return nil
+	}
+
+	before := user.rating()
+	if judgment.RatingChange != nil && before.same(judgment.RatingChange.After) {
+		before = judgment.RatingChange.Before
+	}
+	score := 0.0
+	if *judgment.Correct {
+		score = 1
+	}
+	after := UpdateRating(before, PostRating(judgment.Difficulty), score, judgment.CreatedAt)
+	judgment.RatingChange = &RatingChange{Before: before, After: after}
+	user.Rating = &after
+
+	set := bson.M{"rating": after, "conservative_rating": after.Conservative()}
+	if _, err := uc.collection.UpdateOne(ctx, bson.M{"username": user.Username}, bson.M{"$set": set}); err != nil {
+		return err
+	}
+	_, err := uc.judgments.UpdateOne(ctx, bson.M{"_id": judgment.ID}, bson.M{"$set": bson.M{"rating_change": judgment.RatingChange}})
+	return err
+}
+
+// unrateJudgment takes an undone judgment's effect off the user's rating, as
+// long as nothing has been rated since
+func (uc *UserController) unrateJudgment(ctx context.Context, username string, judgment *Judgment) error {
+	if judgment.RatingChange == nil {
+		return nil
+	}
+
+	var user User
+	if err := uc.collection.FindOne(ctx, bson.M{"username": username}).Decode(&user); err != nil {
+		return err
+	}
+	if !user.rating().same(judgment.RatingChange.After) {
+		return nil
+	}
+
+	before := judgment.RatingChange.Before
+	set := bson.M{"rating": before, "conservative_rating": before.Conservative()}
+	if _, err := uc.collection.UpdateOne(ctx, bson.M{"username": username}, bson.M{"$set": set}); err != nil {
+		return err
+	}
+	_, err := uc.judgments.UpdateOne(ctx, bson.M{"_id": judgment.ID}, bson.M{"$unset": bson.M{"rating_change": ""}})
+	return err
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRatePeriod(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		player Rating
+		games  []ratingGame
+		want   Rating
+	}{
+		{
+			// The worked example in Glickman's "Example of the Glicko-2 system"
+			name:   "Glickman's example",
+			player: Rating{Rating: 1500, Deviation: 200, Volatility: 0.06},
+			games: []ratingGame{
+				{opponent: Rating{Rating: 1400, Deviation: 30}, score: 1},
+				{opponent: Rating{Rating: 1550, Deviation: 100}, score: 0},
+				{opponent: Rating{Rating: 1700, Deviation: 300}, score: 0},
+			},
+			want: Rating{Rating: 1464.06, Deviation: 151.52, Volatility: 0.05999},
+		},
+		{
+			name:   "new player beats an average post",
+			player: NewRating(),
+			games:  []ratingGame{{opponent: PostRating(0.5), score: 1}},
+			want:   Rating{Rating: 1675.07, Deviation: 248.83, Volatility: 0.06},
+		},
+		{
+			name:   "new player misses an average post",
+			player: NewRating(),
+			games:  []ratingGame{{opponent: PostRating(0.5), score: 0}},
+			want:   Rating{Rating: 1324.93, Deviation: 248.83, Volatility: 0.06},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ratePeriod(tt.player, tt.games, now)
+			if math.Abs(got.Rating-tt.want.Rating) > 0.01 ||
+				math.Abs(got.Deviation-tt.want.Deviation) > 0.01 ||
+				math.Abs(got.Volatility-tt.want.Volatility) > 0.00001 {
+				t.Errorf("got %.2f/%.2f/%.5f, want %.2f/%.2f/%.5f",
+					got.Rating, got.Deviation, got.Volatility,
+					tt.want.Rating, tt.want.Deviation, tt.want.Volatility)
+			}
+			if !got.RatedAt.Equal(now) {
+				t.Errorf("RatedAt = %v, want %v", got.RatedAt, now)
+			}
+		})
+	}
+}
+
+func TestUpdateRatingIdleDays(t *testing.T) {
+	rated := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	player := Rating{Rating: 1600, Deviation: 80, Volatility: 0.06, RatedAt: rated}
+	opponent := PostRating(0.3)
+
+	next := UpdateRating(player, opponent, 1, rated.AddDate(0, 0, 1))
+	later := UpdateRating(player, opponent, 1, rated.AddDate(0, 0, 30))
+	if later.Deviation <= next.Deviation {
+		t.Errorf("deviation after 30 idle days = %.2f, want more than %.2f after one", later.Deviation, next.Deviation)
+	}
+	if later.Rating <= next.Rating {
+		t.Errorf("a win after a break moved the rating less (%.2f) than the next day (%.2f)", later.Rating, next.Rating)
+	}
+
+	forever := UpdateRating(player, opponent, 1, rated.AddDate(10, 0, 0))
+	if forever.Deviation > DefaultRatingDeviation {
+		t.Errorf("deviation = %.2f, want at most %.0f", forever.Deviation, DefaultRatingDeviation)
+	}
+}
@@ -80,16 +80,32 @@ func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error
 }
 
 type Post struct {
-    Title       string   `json:"title"`
-    URL         string   `json:"url"`
-    Score       int      `json:"score"`
-    CreatedUTC  float64  `json:"created_utc"`
-    Author      string   `json:"author"`
-    NumComments int      `json:"num_comments"`
-    SelfText    string   `json:"selftext"`
-    Comments    []string `json:"comments"`
-    PostID      string   `json:"id"`
-    IsSelf      bool     `json:"is_self"`
+    Title       string   `json:"title" bson:"title"`
+    URL         string   `json:"url" bson:"url"`
+    Score       int      `json:"score" bson:"score"`
+    CreatedUTC  float64  `json:"created_utc" bson:"created_utc"`
+    Author      string   `json:"author" bson:"author"`
+    NumComments int      `json:"num_comments" bson:"num_comments"`
+    SelfText    string   `json:"selftext" bson:"selftext"`
+    Comments    []string `json:"comments" bson:"comments"`
+    PostID      string   `json:"id" bson:"post_id"`
+    IsSelf      bool     `json:"is_self" bson:"is_self"`
+    Subreddit   string   `json:"subreddit" bson:"subreddit"`
+
+    // Catalogue fields, filled in when the post is stored
+    VerdictCounts    map[string]int  `json:"verdict_counts,omitempty" bson:"verdict_counts,omitempty"`
+    CommunityVerdict string          `json:"community_verdict,omitempty" bson:"community_verdict,omitempty"`
+    DuplicateOf      string          `json:"duplicate_of,omitempty" bson:"duplicate_of,omitempty"`
+    Demographics     *Demographics   `json:"demographics,omitempty" bson:"demographics,omitempty"`
+    Difficulty       *PostDifficulty `json:"difficulty,omitempty" bson:"difficulty,omitempty"`
+    CataloguedAt     time.Time       `json:"-" bson:"catalogued_at,omitempty"`
+
+    // AI enrichment fields
+    TLDR       string    `json:"tldr,omitempty" bson:"tldr,omitempty"`
+    Tags       []string  `json:"tags,omitempty" bson:"tags,omitempty"`
+    AIJudgment string    `json:"ai_judgment,omitempty" bson:"ai_judgment,omitempty"`
+    AIVerdict  string    `json:"ai_verdict,omitempty" bson:"ai_verdict,omitempty"`
+    EnrichedAt time.Time `json:"-" bson:"enriched_at,omitempty"`
 }
 
 func (rc *RedditController) GetSubredditPosts(subreddit string, limit int, timeFilter string) ([]Post, error) {
@@ -187,8 +203,9 @@ func (rc *RedditController) GetSubredditPosts(subreddit string, limit int, timeF
     return posts, nil
 }
 
+// GetPostComments returns the top-level comments on a post, highest voted first
 func (rc *RedditController) GetPostComments(postID string) ([]string, error) {
-    url := fmt.Sprintf("https://oauth.reddit.com/comments/%s?limit=100", postID)
+    url := fmt.Sprintf("https://oauth.reddit.com/comments/%s?limit=100&sort=top", postID)
     
     resp, err := rc.client.Get(url)
     if err != nil {
@@ -290,6 +307,7 @@ func (rc *RedditController) GetPost(postID string) (*Post, error) {
         SelfText:    postData.SelfText,
         PostID:      postData.ID,
         IsSelf:      postData.IsSelf,
+        Subreddit:   postData.Subreddit,
     }
 
     // Fetch comments for this post
@@ -0,0 +1,755 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// Room settings
+const (
+	RoomCodeLength      = 6
+	RoomMaxPlayers      = 50
+	RoomIdleTimeout     = 10 * time.Minute // How long a room nobody has joined is kept
+	DefaultVoteSeconds  = 30
+	MinVoteSeconds      = 5
+	MaxVoteSeconds      = 120
+	roomClientQueueSize = 32 // Events buffered per player before they're disconnected
+)
+
+// Room connection keepalive. The server pings every player, and a
+// connection that sends nothing back, not even a pong, is dropped.
+const (
+	RoomPingInterval = 25 * time.Second
+	RoomReadTimeout  = 60 * time.Second
+	roomWriteTimeout = 10 * time.Second
+)
+
+// roomCodeAlphabet leaves out letters and digits that are easy to mix up
+const roomCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// Room event types, sent from the server to every player
+const (
+	RoomEventState   = "state"   // The whole room, sent to a player when they join
+	RoomEventJoined  = "joined"  // A player joined
+	RoomEventLeft    = "left"    // A player left
+	RoomEventRound   = "round"   // A post is revealed and voting opens
+	RoomEventTally   = "tally"   // Live vote counts
+	RoomEventResults = "results" // Voting closed, with the verdict and scores
+	RoomEventError   = "error"   // Sent only to the player whose message failed
+)
+
+// Room message types, sent from a player to the server
+const (
+	RoomMessageStart  = "start"  // Host: reveal a post and open voting
+	RoomMessageVote   = "vote"   // Vote YTA or NTA, changeable until voting closes
+	RoomMessageReveal = "reveal" // Host: close voting early
+)
+
+// WebSocketTokenProtocol marks the player's token in the WebSocket
+// subprotocols. Browsers can't set an Authorization header on a WebSocket,
+// so they offer the protocols "bearer" and the token instead.
+const WebSocketTokenProtocol = "bearer"
+
+// Room errors
+var (
+	ErrRoomNotFound = errors.New("room not found")
+	ErrRoomFull     = errors.New("room is full")
+	ErrNoRoomPosts  = errors.New("no more posts to play in this room")
+)
+
+// RoomMessage is a message from a player
+type RoomMessage struct {
+	Type    string `json:"type"`
+	PostID  string `json:"post_id,omitempty"` // Start: a particular post, or the next unplayed one
+	Seconds int    `json:"seconds,omitempty"` // Start: how long voting stays open
+	Verdict string `json:"verdict,omitempty"` // Vote: YTA or NTA
+}
+
+// RoomPlayer is a player in a room and their score so far
+type RoomPlayer struct {
+	Username string `json:"username"`
+	Score    int    `json:"score"`
+}
+
+// RoomEvent is a message from the server. Only the fields for the event's
+// type are set.
+type RoomEvent struct {
+	Type     string       `json:"type"`
+	Room     string       `json:"room,omitempty"`
+	Host     string       `json:"host,omitempty"`
+	Players  []RoomPlayer `json:"players,omitempty"`
+	Username string       `json:"username,omitempty"` // Who joined or left
+
+	Round            int               `json:"round,omitempty"`
+	Post             *Post             `json:"post,omitempty"`
+	Deadline         *time.Time        `json:"deadline,omitempty"`
+	Tally            map[string]int    `json:"tally,omitempty"` // Votes for each verdict
+	Voted            int               `json:"voted,omitempty"`
+	Votes            map[string]string `json:"votes,omitempty"` // Each player's vote, once voting closes
+	CommunityVerdict string            `json:"community_verdict,omitempty"`
+
+	Message string `json:"message,omitempty"`
+}
+
+// roomClient is one player's connection. Events are queued so a slow
+// connection can't hold up the room.
+type roomClient struct {
+	username string
+	events   chan RoomEvent
+	conn     io.Closer
+	once     sync.Once
+}
+
+func newRoomClient(username string, conn io.Closer) *roomClient {
+	return &roomClient{username: username, events: make(chan RoomEvent, roomClientQueueSize), conn: conn}
+}
+
+// send queues an event, disconnecting the player if they've fallen too far behind
+func (rc *roomClient) send(event RoomEvent) {
+	select {
+	case rc.events <- event:
+	default:
+		rc.close()
+	}
+}
+
+// close ends the connection; the read loop then removes the player
+func (rc *roomClient) close() {
+	rc.once.Do(func() {
+		if rc.conn != nil {
+			rc.conn.Close()
+		}
+	})
+}
+
+// keepaliveConn pushes the read deadline back whenever anything arrives. The
+// websocket package answers pings and swallows pongs inside Receive, so
+// counting bytes read is the only way to see a pong.
+type keepaliveConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *keepaliveConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	}
+	return n, err
+}
+
+// keepaliveWriter hands the websocket server a keepaliveConn when it hijacks
+// the connection
+type keepaliveWriter struct {
+	gin.ResponseWriter
+	timeout time.Duration
+}
+
+func (w keepaliveWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.ResponseWriter.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	kc := &keepaliveConn{Conn: conn, timeout: w.timeout}
+	if err := kc.SetReadDeadline(time.Now().Add(w.timeout)); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	// Keep anything already buffered from the handshake
+	var reader io.Reader = kc
+	if n := rw.Reader.Buffered(); n > 0 {
+		buffered, _ := rw.Reader.Peek(n)
+		reader = io.MultiReader(bytes.NewReader(buffered), kc)
+	}
+	return kc, bufio.NewReadWriter(bufio.NewReader(reader), bufio.NewWriter(kc)), nil
+}
+
+// roomRound is one post being voted on
+type roomRound struct {
+	number   int
+	post     Post
+	deadline time.Time
+	votes    map[string]string
+	timer    *time.Timer
+	closed   bool
+}
+
+// Room is a game where the host reveals posts and everyone votes against
+// the clock
+type Room struct {
+	Code      string
+	host      string
+	createdAt time.Time
+
+	mu      sync.Mutex
+	clients map[string]*roomClient // Connected players
+	order   []string               // Usernames in the order they joined, to pass on hosting
+	scores  map[string]int         // Kept for players who leave and come back
+	played  []string               // Post IDs already used
+	round   *roomRound
+	closed  bool
+	hub     *RoomHub
+}
+
+// RoomHub holds the rooms being played on this server
+type RoomHub struct {
+	mu       sync.Mutex
+	rooms    map[string]*Room
+	nextPost func(ctx context.Context, exclude []string) (*Post, error)
+	findPost func(ctx context.Context, postID string) (*Post, error)
+	now      func() time.Time
+	after    func(d time.Duration, f func()) *time.Timer // Runs f when voting time is up
+}
+
+// NewRoomHub creates a hub that deals posts from the catalogue, only using
+// posts with a community verdict so votes can be scored. Posts in the daily
+// challenge or a duel are never played, since results reveal their verdicts.
+func NewRoomHub(uc *UserController) *RoomHub {
+	loadPost := func(ctx context.Context, postID string) (*Post, error) {
+		withheld, err := uc.WithheldPosts(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if withheld[postID] {
+			return nil, fmt.Errorf("post %s is in play elsewhere", postID)
+		}
+		posts, err := uc.orderedPosts(ctx, []string{postID})
+		if err != nil {
+			return nil, err
+		}
+		if len(posts) == 0 || VerdictSide(posts[0].CommunityVerdict) == "" {
+			return nil, fmt.Errorf("post %s can't be played", postID)
+		}
+		return &posts[0], nil
+	}
+	return &RoomHub{
+		rooms: make(map[string]*Room),
+		nextPost: func(ctx context.Context, exclude []string) (*Post, error) {
+			withheld, err := uc.WithheldPosts(ctx)
+			if err != nil {
+				return nil, err
+			}
+			exclude = append([]string{}, exclude...)
+			for postID := range withheld {
+				exclude = append(exclude, postID)
+			}
+			candidates, err := uc.scorablePostIDs(ctx, exclude)
+			if err != nil {
+				return nil, err
+			}
+			if len(candidates) == 0 {
+				return nil, ErrNoRoomPosts
+			}
+			pick, err := rand.Int(rand.Reader, big.NewInt(int64(len(candidates))))
+			if err != nil {
+				return nil, err
+			}
+			return loadPost(ctx, candidates[pick.Int64()])
+		},
+		findPost: loadPost,
+		now:      time.Now,
+		after:    time.AfterFunc,
+	}
+}
+
+// newRoomCode returns a random code that's easy to read out
+func newRoomCode() (string, error) {
+	code := make([]byte, RoomCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(roomCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = roomCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// Create opens a room hosted by the user, clearing out rooms nobody joined
+func (h *RoomHub) Create(host string) (*Room, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for code, room := range h.rooms {
+		if room.abandoned(h.now()) {
+			delete(h.rooms, code)
+		}
+	}
+
+	for {
+		code, err := newRoomCode()
+		if err != nil {
+			return nil, err
+		}
+		if _, taken := h.rooms[code]; taken {
+			continue
+		}
+		room := &Room{
+			Code:      code,
+			host:      host,
+			createdAt: h.now(),
+			clients:   make(map[string]*roomClient),
+			scores:    make(map[string]int),
+			hub:       h,
+		}
+		h.rooms[code] = room
+		return room, nil
+	}
+}
+
+// Find returns the open room with the code
+func (h *RoomHub) Find(code string) (*Room, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	room, ok := h.rooms[code]
+	if !ok {
+		return nil, ErrRoomNotFound
+	}
+	return room, nil
+}
+
+// remove drops a room that has closed
+func (h *RoomHub) remove(room *Room) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.rooms[room.Code] == room {
+		delete(h.rooms, room.Code)
+	}
+}
+
+// abandoned reports whether nobody has joined the room since it was created
+func (r *Room) abandoned(now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.clients) == 0 && len(r.order) == 0 && now.Sub(r.createdAt) > RoomIdleTimeout
+}
+
+// Snapshot returns the room's host and players
+func (r *Room) Snapshot() RoomEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state()
+}
+
+// state describes the room, including the round being played. The caller
+// holds the lock.
+func (r *Room) state() RoomEvent {
+	event := RoomEvent{Type: RoomEventState, Room: r.Code, Host: r.host, Players: r.players()}
+	if r.round != nil {
+		event.Round = r.round.number
+		if r.round.closed {
+			r.addResults(&event)
+		} else {
+			r.addRound(&event)
+			r.addTally(&event)
+		}
+	}
+	return event
+}
+
+// players lists the connected players in the order they joined
+func (r *Room) players() []RoomPlayer {
+	players := []RoomPlayer{}
+	for _, username := range r.order {
+		if _, ok := r.clients[username]; ok {
+			players = append(players, RoomPlayer{Username: username, Score: r.scores[username]})
+		}
+	}
+	return players
+}
+
+// broadcast sends an event to every connected player
+func (r *Room) broadcast(event RoomEvent) {
+	for _, client := range r.clients {
+		client.send(event)
+	}
+}
+
+// join adds a player. A player who connects again replaces their old connection.
+func (r *Room) join(client *roomClient) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrRoomNotFound
+	}
+	if old, ok := r.clients[client.username]; ok {
+		old.close()
+	} else if len(r.clients) >= RoomMaxPlayers {
+		return ErrRoomFull
+	}
+
+	r.clients[client.username] = client
+	if _, seen := r.scores[client.username]; !seen {
+		r.scores[client.username] = 0
+		r.order = append(r.order, client.username)
+	}
+	client.send(r.state())
+	r.broadcast(RoomEvent{Type: RoomEventJoined, Username: client.username, Host: r.host, Players: r.players()})
+	return nil
+}
+
+// leave removes a player's connection. The host's role passes to whoever
+// joined next, and the room closes when the last player leaves.
+func (r *Room) leave(client *roomClient) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.clients[client.username] != client {
+		return // Already replaced by a newer connection
+	}
+	delete(r.clients, client.username)
+
+	if len(r.clients) == 0 {
+		r.closed = true
+		if r.round != nil && r.round.timer != nil {
+			r.round.timer.Stop()
+		}
+		go r.hub.remove(r)
+		return
+	}
+	if client.username == r.host {
+		for _, username := range r.order {
+			if _, ok := r.clients[username]; ok {
+				r.host = username
+				break
+			}
+		}
+	}
+	r.broadcast(RoomEvent{Type: RoomEventLeft, Username: client.username, Host: r.host, Players: r.players()})
+
+	// Everyone still here may have voted already
+	if r.round != nil && !r.round.closed && r.allVoted() {
+		r.closeRound()
+	}
+}
+
+// handle acts on a message from a player, replying with an error event if it
+// can't be done
+func (r *Room) handle(client *roomClient, msg RoomMessage) {
+	var err error
+	switch msg.Type {
+	case RoomMessageStart:
+		err = r.start(client.username, msg)
+	case RoomMessageVote:
+		err = r.vote(client.username, msg.Verdict)
+	case RoomMessageReveal:
+		err = r.reveal(client.username)
+	default:
+		err = fmt.Errorf("unknown message type %q", msg.Type)
+	}
+	if err != nil {
+		client.send(RoomEvent{Type: RoomEventError, Message: err.Error()})
+	}
+}
+
+// start reveals a post to everyone at once and opens voting
+func (r *Room) start(username string, msg RoomMessage) error {
+	seconds := msg.Seconds
+	if seconds == 0 {
+		seconds = DefaultVoteSeconds
+	}
+	if seconds < MinVoteSeconds || seconds > MaxVoteSeconds {
+		return fmt.Errorf("seconds must be between %d and %d", MinVoteSeconds, MaxVoteSeconds)
+	}
+
+	// Pick the post without holding the lock, so the room carries on while
+	// the catalogue is queried
+	r.mu.Lock()
+	err := r.canStart(username)
+	played := append([]string(nil), r.played...)
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var post *Post
+	if msg.PostID != "" {
+		post, err = r.hub.findPost(ctx, msg.PostID)
+	} else {
+		post, err = r.hub.nextPost(ctx, played)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// The host may have changed or another round started in the meantime
+	if err := r.canStart(username); err != nil {
+		return err
+	}
+
+	number := 1
+	if r.round != nil {
+		number = r.round.number + 1
+	}
+	round := &roomRound{
+		number:   number,
+		post:     *post,
+		deadline: r.hub.now().Add(time.Duration(seconds) * time.Second),
+		votes:    make(map[string]string),
+	}
+	round.timer = r.hub.after(time.Duration(seconds)*time.Second, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.round == round && !round.closed {
+			r.closeRound()
+		}
+	})
+	r.round = round
+	r.played = append(r.played, post.PostID)
+
+	event := RoomEvent{Type: RoomEventRound, Round: number}
+	r.addRound(&event)
+	r.broadcast(event)
+	return nil
+}
+
+// canStart reports why the user can't start a round now, if they can't. The
+// caller holds the lock.
+func (r *Room) canStart(username string) error {
+	switch {
+	case r.closed:
+		return ErrRoomNotFound
+	case username != r.host:
+		return errors.New("only the host can start a round")
+	case r.round != nil && !r.round.closed:
+		return errors.New("a round is already in progress")
+	default:
+		return nil
+	}
+}
+
+// vote records a player's verdict and shows everyone the new counts. Voting
+// closes as soon as every player has voted.
+func (r *Room) vote(username, verdict string) error {
+	if verdict != VerdictYTA && verdict != VerdictNTA {
+		return errors.New("verdict must be YTA or NTA")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.round == nil || r.round.closed {
+		return errors.New("voting is closed")
+	}
+	r.round.votes[username] = verdict
+
+	event := RoomEvent{Type: RoomEventTally, Round: r.round.number}
+	r.addTally(&event)
+	r.broadcast(event)
+
+	if r.allVoted() {
+		r.closeRound()
+	}
+	return nil
+}
+
+// reveal lets the host close voting before the timer runs out
+func (r *Room) reveal(username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if username != r.host {
+		return errors.New("only the host can close voting")
+	}
+	if r.round == nil || r.round.closed {
+		return errors.New("voting is closed")
+	}
+	r.closeRound()
+	return nil
+}
+
+// allVoted reports whether every connected player has voted. The caller
+// holds the lock.
+func (r *Room) allVoted() bool {
+	for username := range r.clients {
+		if _, ok := r.round.votes[username]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// closeRound scores the votes against the community verdict and sends
+// everyone the results. The caller holds the lock.
+func (r *Room) closeRound() {
+	r.round.closed = true
+	r.round.timer.Stop()
+
+	answer := VerdictSide(r.round.post.CommunityVerdict)
+	for username, verdict := range r.round.votes {
+		if verdict == answer {
+			r.scores[username]++
+		}
+	}
+
+	event := RoomEvent{Type: RoomEventResults, Round: r.round.number, Players: r.players()}
+	r.addResults(&event)
+	r.broadcast(event)
+}
+
+// addRound adds the round's post, without its verdicts, and deadline
+func (r *Room) addRound(event *RoomEvent) {
+	posts := []Post{r.round.post}
+	hideVerdicts(posts)
+	deadline := r.round.deadline
+	event.Post = &posts[0]
+	event.Deadline = &deadline
+}
+
+// addTally adds how many players voted each way, without saying who
+func (r *Room) addTally(event *RoomEvent) {
+	event.Tally = map[string]int{VerdictYTA: 0, VerdictNTA: 0}
+	for _, verdict := range r.round.votes {
+		event.Tally[verdict]++
+	}
+	event.Voted = len(r.round.votes)
+}
+
+// addResults adds the round's post with its verdicts and everyone's votes
+func (r *Room) addResults(event *RoomEvent) {
+	post := r.round.post
+	event.Post = &post
+	event.CommunityVerdict = post.CommunityVerdict
+	event.Votes = r.round.votes
+	r.addTally(event)
+}
+
+// CreateRoom opens a room hosted by the user and returns its code
+func (h *RoomHub) CreateRoom(c *gin.Context) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	room, err := h.Create(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create room", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"code": room.Code, "host": username})
+}
+
+// GetRoom returns a room's host and players, for checking a code before joining
+func (h *RoomHub) GetRoom(c *gin.Context) {
+	room, err := h.Find(c.Param("code"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+	state := room.Snapshot()
+	c.JSON(http.StatusOK, gin.H{"code": room.Code, "host": state.Host, "players": state.Players, "round": state.Round})
+}
+
+// webSocketToken returns the token from a Sec-WebSocket-Protocol header of
+// the form "bearer, <token>"
+func webSocketToken(header string) (string, bool) {
+	protocols := strings.Split(header, ",")
+	if len(protocols) != 2 || strings.TrimSpace(protocols[0]) != WebSocketTokenProtocol {
+		return "", false
+	}
+	token := strings.TrimSpace(protocols[1])
+	return token, token != ""
+}
+
+// JoinRoom upgrades the request to a WebSocket and plays the user in the
+// room until they disconnect. Messages in both directions are JSON: the
+// player sends RoomMessages and receives RoomEvents.
+func (h *RoomHub) JoinRoom(c *gin.Context) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	room, err := h.Find(c.Param("code"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	server := websocket.Server{
+		// Players authenticate with their token, and mobile clients don't
+		// send an Origin, so any origin is accepted
+		Handshake: func(config *websocket.Config, _ *http.Request) error {
+			// Agree to the token protocol without echoing the token back
+			if slices.Contains(config.Protocol, WebSocketTokenProtocol) {
+				config.Protocol = []string{WebSocketTokenProtocol}
+			} else {
+				config.Protocol = nil
+			}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			client := newRoomClient(username, ws)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				ping := time.NewTicker(RoomPingInterval)
+				defer ping.Stop()
+				for {
+					var err error
+					select {
+					case event, ok := <-client.events:
+						if !ok {
+							return
+						}
+						ws.SetWriteDeadline(time.Now().Add(roomWriteTimeout))
+						err = websocket.JSON.Send(ws, event)
+					case <-ping.C:
+						// Only this goroutine writes, so it owns PayloadType
+						ws.SetWriteDeadline(time.Now().Add(roomWriteTimeout))
+						ws.PayloadType = websocket.PingFrame
+						_, err = ws.Write(nil)
+					}
+					if err != nil {
+						client.close()
+						return
+					}
+				}
+			}()
+
+			if err := room.join(client); err != nil {
+				websocket.JSON.Send(ws, RoomEvent{Type: RoomEventError, Message: err.Error()})
+			} else {
+				for {
+					var msg RoomMessage
+					if err := websocket.JSON.Receive(ws, &msg); err != nil {
+						break
+					}
+					room.handle(client, msg)
+				}
+				room.leave(client)
+			}
+
+			// Stop taking events and let the writer finish
+			room.mu.Lock()
+			close(client.events)
+			room.mu.Unlock()
+			<-done
+			client.close()
+		},
+	}
+	server.ServeHTTP(keepaliveWriter{ResponseWriter: c.Writer, timeout: RoomReadTimeout}, c.Request)
+}
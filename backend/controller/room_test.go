@@ -0,0 +1,387 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeConn records whether the room closed a player's connection
+type fakeConn struct {
+	closed bool
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+// testHub deals the given posts in order and captures the voting timer so
+// tests can run it
+type testHub struct {
+	*RoomHub
+	now   time.Time
+	timer func()
+}
+
+func newTestHub(posts ...Post) *testHub {
+	h := &testHub{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	byID := make(map[string]Post, len(posts))
+	for _, post := range posts {
+		byID[post.PostID] = post
+	}
+	h.RoomHub = &RoomHub{
+		rooms: make(map[string]*Room),
+		nextPost: func(_ context.Context, exclude []string) (*Post, error) {
+			for _, post := range posts {
+				if !containsPostID(exclude, post.PostID) {
+					return &post, nil
+				}
+			}
+			return nil, ErrNoRoomPosts
+		},
+		findPost: func(_ context.Context, postID string) (*Post, error) {
+			post, ok := byID[postID]
+			if !ok {
+				return nil, errors.New("post can't be played")
+			}
+			return &post, nil
+		},
+		now: func() time.Time { return h.now },
+		after: func(_ time.Duration, f func()) *time.Timer {
+			h.timer = f
+			return time.NewTimer(time.Hour)
+		},
+	}
+	return h
+}
+
+func containsPostID(ids []string, id string) bool {
+	for _, other := range ids {
+		if other == id {
+			return true
+		}
+	}
+	return false
+}
+
+// joinPlayers opens a room hosted by the first player and joins everyone
+func joinPlayers(t *testing.T, h *testHub, usernames ...string) (*Room, map[string]*roomClient) {
+	t.Helper()
+	room, err := h.Create(usernames[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients := make(map[string]*roomClient, len(usernames))
+	for _, username := range usernames {
+		clients[username] = newRoomClient(username, &fakeConn{})
+		if err := room.join(clients[username]); err != nil {
+			t.Fatalf("join %s: %v", username, err)
+		}
+	}
+	for _, client := range clients {
+		drain(client)
+	}
+	return room, clients
+}
+
+// drain returns the events queued for a player
+func drain(client *roomClient) []RoomEvent {
+	var events []RoomEvent
+	for {
+		select {
+		case event := <-client.events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+// lastEvent returns the type of the last event queued for a player
+func lastEvent(client *roomClient) RoomEvent {
+	events := drain(client)
+	if len(events) == 0 {
+		return RoomEvent{}
+	}
+	return events[len(events)-1]
+}
+
+func TestRoomJoin(t *testing.T) {
+	h := newTestHub(Post{PostID: "p1", CommunityVerdict: VerdictNTA})
+	room, clients := joinPlayers(t, h, "alice", "bob")
+
+	if err := room.start("alice", RoomMessage{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.vote("bob", VerdictNTA); err != nil {
+		t.Fatal(err)
+	}
+	drain(clients["alice"])
+
+	// Reconnecting replaces the old connection and keeps the player's place
+	oldConn := clients["bob"].conn.(*fakeConn)
+	rejoined := newRoomClient("bob", &fakeConn{})
+	if err := room.join(rejoined); err != nil {
+		t.Fatal(err)
+	}
+	if !oldConn.closed {
+		t.Error("old connection wasn't closed")
+	}
+	state := drain(rejoined)[0]
+	if state.Type != RoomEventState || state.Round != 1 || state.Voted != 1 || state.Post == nil || state.Post.CommunityVerdict != "" {
+		t.Errorf("rejoin state = %+v", state)
+	}
+	if got := room.Snapshot().Players; len(got) != 2 {
+		t.Errorf("players = %v, want alice and bob", got)
+	}
+
+	// The replaced connection closing doesn't remove the player
+	room.leave(clients["bob"])
+	if got := room.Snapshot().Players; len(got) != 2 {
+		t.Errorf("players after old connection left = %v", got)
+	}
+}
+
+func TestRoomHostOnly(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		player  string
+		wantErr bool
+	}{
+		{name: "host starts", message: RoomMessageStart, player: "alice"},
+		{name: "player can't start", message: RoomMessageStart, player: "bob", wantErr: true},
+		{name: "host reveals", message: RoomMessageReveal, player: "alice"},
+		{name: "player can't reveal", message: RoomMessageReveal, player: "bob", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHub(Post{PostID: "p1", CommunityVerdict: VerdictYTA})
+			room, clients := joinPlayers(t, h, "alice", "bob")
+			if tt.message == RoomMessageReveal {
+				if err := room.start("alice", RoomMessage{}); err != nil {
+					t.Fatal(err)
+				}
+				drain(clients[tt.player])
+			}
+
+			room.handle(clients[tt.player], RoomMessage{Type: tt.message})
+			event := lastEvent(clients[tt.player])
+			if gotErr := event.Type == RoomEventError; gotErr != tt.wantErr {
+				t.Errorf("last event = %+v, want error %v", event, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRoomStart(t *testing.T) {
+	h := newTestHub(Post{PostID: "p1", CommunityVerdict: VerdictYTA}, Post{PostID: "p2", CommunityVerdict: VerdictNTA})
+	room, clients := joinPlayers(t, h, "alice", "bob")
+
+	if err := room.start("alice", RoomMessage{Seconds: MaxVoteSeconds + 1}); err == nil {
+		t.Error("start allowed too long a vote")
+	}
+	if err := room.start("alice", RoomMessage{}); err != nil {
+		t.Fatal(err)
+	}
+	round := lastEvent(clients["bob"])
+	if round.Type != RoomEventRound || round.Post.PostID != "p1" || round.Post.CommunityVerdict != "" {
+		t.Errorf("round event = %+v, want p1 without its verdict", round)
+	}
+	if err := room.start("alice", RoomMessage{}); err == nil {
+		t.Error("start allowed during a round")
+	}
+
+	// Played posts aren't dealt again
+	room.reveal("alice")
+	if err := room.start("alice", RoomMessage{}); err != nil {
+		t.Fatal(err)
+	}
+	if round := lastEvent(clients["bob"]); round.Round != 2 || round.Post.PostID != "p2" {
+		t.Errorf("second round = %+v, want p2", round)
+	}
+	room.reveal("alice")
+	if err := room.start("alice", RoomMessage{}); !errors.Is(err, ErrNoRoomPosts) {
+		t.Errorf("start with no posts left = %v, want ErrNoRoomPosts", err)
+	}
+	if err := room.start("alice", RoomMessage{PostID: "p1"}); err != nil {
+		t.Errorf("start with a chosen post = %v", err)
+	}
+}
+
+func TestRoomVotingCloses(t *testing.T) {
+	tests := []struct {
+		name  string
+		votes []string // Players who vote NTA
+		then  func(h *testHub, room *Room)
+	}{
+		{
+			name:  "everyone voted",
+			votes: []string{"alice", "bob", "carol"},
+		},
+		{
+			name:  "timer runs out",
+			votes: []string{"alice"},
+			then:  func(h *testHub, room *Room) { h.timer() },
+		},
+		{
+			name:  "host reveals",
+			votes: []string{"bob"},
+			then:  func(h *testHub, room *Room) { room.reveal("alice") },
+		},
+		{
+			name:  "last player yet to vote leaves",
+			votes: []string{"alice", "bob"},
+			then:  func(h *testHub, room *Room) { room.leave(room.clients["carol"]) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHub(Post{PostID: "p1", CommunityVerdict: VerdictNTA})
+			room, clients := joinPlayers(t, h, "alice", "bob", "carol")
+			if err := room.start("alice", RoomMessage{}); err != nil {
+				t.Fatal(err)
+			}
+			for _, username := range tt.votes {
+				if err := room.vote(username, VerdictNTA); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.then != nil {
+				if event := lastEvent(clients["alice"]); event.Type == RoomEventResults {
+					t.Fatal("voting closed early")
+				}
+				tt.then(h, room)
+			}
+
+			results := lastEvent(clients["alice"])
+			if results.Type != RoomEventResults || results.CommunityVerdict != VerdictNTA || len(results.Votes) != len(tt.votes) {
+				t.Errorf("last event = %+v, want results", results)
+			}
+			if err := room.vote("bob", VerdictYTA); err == nil {
+				t.Error("vote accepted after voting closed")
+			}
+		})
+	}
+}
+
+func TestRoomScoring(t *testing.T) {
+	tests := []struct {
+		community string
+		votes     map[string]string
+		want      map[string]int
+	}{
+		{
+			community: VerdictNTA,
+			votes:     map[string]string{"alice": VerdictNTA, "bob": VerdictYTA},
+			want:      map[string]int{"alice": 1, "bob": 0},
+		},
+		{
+			community: VerdictESH,
+			votes:     map[string]string{"alice": VerdictNTA, "bob": VerdictYTA},
+			want:      map[string]int{"alice": 0, "bob": 1},
+		},
+		{
+			community: VerdictNAH,
+			votes:     map[string]string{"alice": VerdictNTA, "bob": VerdictNTA},
+			want:      map[string]int{"alice": 1, "bob": 1},
+		},
+		{
+			community: VerdictYTA,
+			votes:     map[string]string{"alice": VerdictYTA},
+			want:      map[string]int{"alice": 1, "bob": 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.community, func(t *testing.T) {
+			h := newTestHub(Post{PostID: "p1", CommunityVerdict: tt.community})
+			room, clients := joinPlayers(t, h, "alice", "bob")
+			if err := room.start("alice", RoomMessage{}); err != nil {
+				t.Fatal(err)
+			}
+			for username, verdict := range tt.votes {
+				if err := room.vote(username, verdict); err != nil {
+					t.Fatal(err)
+				}
+			}
+			room.reveal("alice")
+
+			for _, player := range lastEvent(clients["bob"]).Players {
+				if player.Score != tt.want[player.Username] {
+					t.Errorf("%s scored %d, want %d", player.Username, player.Score, tt.want[player.Username])
+				}
+			}
+		})
+	}
+
+	// Invalid votes don't count
+	h := newTestHub(Post{PostID: "p1", CommunityVerdict: VerdictNTA})
+	room, _ := joinPlayers(t, h, "alice")
+	room.start("alice", RoomMessage{})
+	if err := room.vote("alice", VerdictESH); err == nil {
+		t.Error("vote accepted a verdict players can't choose")
+	}
+}
+
+func TestRoomHostHandover(t *testing.T) {
+	h := newTestHub(Post{PostID: "p1", CommunityVerdict: VerdictNTA})
+	room, clients := joinPlayers(t, h, "alice", "bob", "carol")
+
+	room.leave(clients["alice"])
+	left := lastEvent(clients["carol"])
+	if left.Type != RoomEventLeft || left.Username != "alice" || left.Host != "bob" {
+		t.Errorf("left event = %+v, want bob hosting", left)
+	}
+	if err := room.start("bob", RoomMessage{}); err != nil {
+		t.Errorf("new host can't start: %v", err)
+	}
+
+	// The old host comes back as a player and keeps their score
+	returned := newRoomClient("alice", &fakeConn{})
+	if err := room.join(returned); err != nil {
+		t.Fatal(err)
+	}
+	if state := drain(returned)[0]; state.Host != "bob" {
+		t.Errorf("host after rejoining = %q, want bob", state.Host)
+	}
+	if err := room.reveal("alice"); err == nil {
+		t.Error("old host could still close voting")
+	}
+}
+
+func TestRoomRemoval(t *testing.T) {
+	h := newTestHub(Post{PostID: "p1", CommunityVerdict: VerdictNTA})
+	room, clients := joinPlayers(t, h, "alice", "bob")
+	room.start("alice", RoomMessage{})
+
+	room.leave(clients["alice"])
+	room.leave(clients["bob"])
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := h.Find(room.Code); errors.Is(err, ErrRoomNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("empty room wasn't removed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := room.join(newRoomClient("carol", &fakeConn{})); !errors.Is(err, ErrRoomNotFound) {
+		t.Errorf("join closed room = %v, want ErrRoomNotFound", err)
+	}
+
+	// Rooms nobody joins are cleared out once they've been idle
+	idle, err := h.Create("dave")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.now = h.now.Add(RoomIdleTimeout + time.Second)
+	if _, err := h.Create("erin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Find(idle.Code); !errors.Is(err, ErrRoomNotFound) {
+		t.Errorf("idle room still open: %v", err)
+	}
+}
@@ -0,0 +1,380 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultFeedLimit is how many friend judgments the feed returns by default
+const DefaultFeedLimit = 20
+
+// Leaderboard scopes
+const (
+	ScopeGlobal  = "global"
+	ScopeFriends = "friends"
+)
+
+// Follow is one user following another. Two users who follow each other are
+// friends; a friend request is a follow that asks to be followed back.
+type Follow struct {
+	Follower  string    `json:"follower" bson:"follower"`
+	Followee  string    `json:"followee" bson:"followee"`
+	Requested bool      `json:"requested,omitempty" bson:"requested,omitempty"` // Friend request awaiting an answer
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// FriendJudgment is a friend's verdict on a post the viewer also judged
+type FriendJudgment struct {
+	Judgment  `bson:",inline"`
+	MyVerdict string `json:"my_verdict" bson:"my_verdict"`
+	Agreed    bool   `json:"agreed" bson:"agreed"`
+}
+
+// createFollowIndexes allows one follow per pair and looks up both directions
+func (uc *UserController) createFollowIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := uc.follows.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "follower", Value: 1}, {Key: "followee", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "followee", Value: 1}, {Key: "follower", Value: 1}},
+		},
+	})
+	if err != nil {
+		fmt.Println("Failed to create follows indexes:", err)
+	}
+}
+
+// follow makes follower follow followee, optionally as a friend request.
+// Following someone who already follows you accepts their request.
+func (uc *UserController) follow(ctx context.Context, follower, followee string, request bool) error {
+	if follower == followee {
+		return errors.New("you can't follow yourself")
+	}
+	if err := uc.collection.FindOne(ctx, bson.M{"username": followee}).Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Errorf("user %s not found", followee)
+		}
+		return err
+	}
+
+	// A follow back answers any request the other way
+	result, err := uc.follows.UpdateOne(ctx,
+		bson.M{"follower": followee, "followee": follower},
+		bson.M{"$unset": bson.M{"requested": ""}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		request = false
+	}
+
+	update := bson.M{"$setOnInsert": bson.M{"created_at": uc.now()}}
+	if request {
+		update["$set"] = bson.M{"requested": true}
+	}
+	_, err = uc.follows.UpdateOne(ctx,
+		bson.M{"follower": follower, "followee": followee},
+		update,
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// among limits a leaderboard to the given players
+func (q leaderboardQuery) among(usernames []string) leaderboardQuery {
+	filter := bson.D{{Key: "$match", Value: bson.M{"username": bson.M{"$in": usernames}}}}
+	q.players = append(mongo.Pipeline{filter}, q.players...)
+	return q
+}
+
+// unfollow stops follower following followee, which also ends a friendship
+func (uc *UserController) unfollow(ctx context.Context, follower, followee string) error {
+	_, err := uc.follows.DeleteOne(ctx, bson.M{"follower": follower, "followee": followee})
+	return err
+}
+
+// following returns who the user follows
+func (uc *UserController) following(ctx context.Context, username string) ([]string, error) {
+	return uc.followUsernames(ctx, bson.M{"follower": username}, "followee")
+}
+
+// followers returns who follows the user
+func (uc *UserController) followers(ctx context.Context, username string) ([]string, error) {
+	return uc.followUsernames(ctx, bson.M{"followee": username}, "follower")
+}
+
+// friends returns the users who follow the user back
+func (uc *UserController) friends(ctx context.Context, username string) ([]string, error) {
+	following, err := uc.following(ctx, username)
+	if err != nil || len(following) == 0 {
+		return []string{}, err
+	}
+	return uc.followUsernames(ctx, bson.M{"followee": username, "follower": bson.M{"$in": following}}, "follower")
+}
+
+// followUsernames returns one side of the follows matching filter
+func (uc *UserController) followUsernames(ctx context.Context, filter bson.M, side string) ([]string, error) {
+	cursor, err := uc.follows.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	var follows []Follow
+	if err := cursor.All(ctx, &follows); err != nil {
+		return nil, err
+	}
+	usernames := make([]string, len(follows))
+	for i, follow := range follows {
+		usernames[i] = follow.Followee
+		if side == "follower" {
+			usernames[i] = follow.Follower
+		}
+	}
+	return usernames, nil
+}
+
+// Follow follows another user
+func (uc *UserController) Follow(c *gin.Context) {
+	uc.followHandler(c, false)
+}
+
+// SendFriendRequest follows another user and asks them to follow back
+func (uc *UserController) SendFriendRequest(c *gin.Context) {
+	uc.followHandler(c, true)
+}
+
+// AcceptFriendRequest follows back a user who sent a friend request
+func (uc *UserController) AcceptFriendRequest(c *gin.Context) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	other := c.Param("username")
+	err := uc.follows.FindOne(ctx, bson.M{"follower": other, "followee": username, "requested": true}).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Friend request not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find friend request", "details": err.Error()})
+		return
+	}
+
+	if err := uc.follow(ctx, username, other, false); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept friend request", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Friend request accepted", "friend": other})
+}
+
+// DeclineFriendRequest turns down a friend request. The other user keeps
+// following you.
+func (uc *UserController) DeclineFriendRequest(c *gin.Context) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	result, err := uc.follows.UpdateOne(context.Background(),
+		bson.M{"follower": c.Param("username"), "followee": username, "requested": true},
+		bson.M{"$unset": bson.M{"requested": ""}},
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decline friend request", "details": err.Error()})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Friend request not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Friend request declined"})
+}
+
+// Unfollow stops following another user, ending any friendship
+func (uc *UserController) Unfollow(c *gin.Context) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := uc.unfollow(context.Background(), username, c.Param("username")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unfollow user", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Unfollowed " + c.Param("username")})
+}
+
+// followHandler follows the user in the path, optionally as a friend request
+func (uc *UserController) followHandler(c *gin.Context, request bool) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := uc.follow(ctx, username, c.Param("username"), request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to follow user", "details": err.Error()})
+		return
+	}
+	message := "Following " + c.Param("username")
+	if request {
+		message = "Friend request sent to " + c.Param("username")
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// GetSocial lists who the user follows, who follows them, their friends and
+// their incoming friend requests
+func (uc *UserController) GetSocial(c *gin.Context) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	following, err := uc.following(ctx, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch following", "details": err.Error()})
+		return
+	}
+	followers, err := uc.followers(ctx, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch followers", "details": err.Error()})
+		return
+	}
+	friends, err := uc.friends(ctx, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch friends", "details": err.Error()})
+		return
+	}
+	requests, err := uc.followUsernames(ctx, bson.M{"followee": username, "requested": true}, "follower")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch friend requests", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"following":       following,
+		"followers":       followers,
+		"friends":         friends,
+		"friend_requests": requests,
+	})
+}
+
+// GetFriendFeed returns friends' most recent judgments on posts the user has
+// also judged, with whether they agreed
+func (uc *UserController) GetFriendFeed(c *gin.Context) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(DefaultFeedLimit)))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	friends, err := uc.friends(ctx, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch friends", "details": err.Error()})
+		return
+	}
+
+	// Start from the posts the viewer judged, so only friends' judgments on
+	// those are read
+	cursor, err := uc.judgments.Find(ctx,
+		bson.M{"username": username, "undone_at": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"post_id": 1, "verdict": 1, "created_at": 1, "first_judged_at": 1}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch judgments", "details": err.Error()})
+		return
+	}
+	var mine []Judgment
+	if err := cursor.All(ctx, &mine); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode judgments", "details": err.Error()})
+		return
+	}
+	now := uc.now()
+	myVerdicts := make(map[string]string, len(mine))
+	changeable := make(map[string]bool)
+	postIDs := make([]string, len(mine))
+	for i, judgment := range mine {
+		myVerdicts[judgment.PostID] = judgment.Verdict
+		changeable[judgment.PostID] = judgment.InUndoWindow(now)
+		postIDs[i] = judgment.PostID
+	}
+
+	feed := []FriendJudgment{}
+	if len(friends) == 0 || len(postIDs) == 0 {
+		c.JSON(http.StatusOK, gin.H{"results": feed})
+		return
+	}
+	cursor, err = uc.judgments.Find(ctx,
+		bson.M{
+			"username":  bson.M{"$in": friends},
+			"post_id":   bson.M{"$in": postIDs},
+			"undone_at": bson.M{"$exists": false},
+		},
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}}).
+			SetLimit(int64(limit)).
+			SetProjection(bson.M{"revisions": 0, "rating_change": 0}),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch feed", "details": err.Error()})
+		return
+	}
+	var judgments []Judgment
+	if err := cursor.All(ctx, &judgments); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode feed", "details": err.Error()})
+		return
+	}
+	withheld, err := uc.WithheldPosts(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check posts in play", "details": err.Error()})
+		return
+	}
+	for _, judgment := range judgments {
+		// Friends' answers mustn't give away the verdict while the viewer
+		// can still change theirs or the post is in play
+		if changeable[judgment.PostID] || withheld[judgment.PostID] {
+			judgment = judgment.hideAnswer()
+		}
+		myVerdict := myVerdicts[judgment.PostID]
+		feed = append(feed, FriendJudgment{Judgment: judgment, MyVerdict: myVerdict, Agreed: judgment.Verdict == myVerdict})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": feed})
+}
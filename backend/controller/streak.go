@@ -0,0 +1,229 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Streak freeze rules. A freeze is a grace day: if the player misses a day,
+// a banked freeze is spent to keep the streak alive.
+const (
+	FreezeEarnEvery  = 7 // Streak days needed to earn a freeze
+	MaxStreakFreezes = 2 // Most freezes that can be banked at once
+)
+
+// maxStreakDates keeps the stored list of active days manageable
+const maxStreakDates = 30
+
+// Streak is a player's streak state. Dates are midnights in the player's
+// timezone, oldest first.
+type Streak struct {
+	Dates       []time.Time
+	Count       int
+	Longest     int
+	Freezes     int
+	FrozenDates []time.Time // Missed days covered by a freeze
+
+	// What the latest day changed, so it can be taken back
+	PrevLongest  int  // Longest before the latest day
+	EarnedFreeze bool // Whether the latest day earned a freeze
+}
+
+// RecordStreakDay returns the streak after the player is active at now,
+// counting days in loc. Being active again on the same day changes nothing.
+func RecordStreakDay(streak Streak, now time.Time, loc *time.Location) Streak {
+	today := localMidnight(now, loc)
+	if len(streak.Dates) > 0 {
+		last := normaliseStreakDate(streak.Dates[len(streak.Dates)-1], loc)
+		missed := daysBetween(last, today) - 1
+		switch {
+		case missed < 0:
+			// Already active today (or the clock went backwards)
+			return streak
+		case missed == 0:
+			streak.Count++
+		case missed <= streak.Freezes:
+			streak.Freezes -= missed
+			for i := 1; i <= missed; i++ {
+				streak.FrozenDates = append(streak.FrozenDates, last.AddDate(0, 0, i))
+			}
+			streak.Count++
+		default:
+			streak.Count = 1
+		}
+	} else {
+		streak.Count = 1
+	}
+
+	streak.Dates = append(streak.Dates, today)
+	streak.PrevLongest = streak.Longest
+	if streak.Count > streak.Longest {
+		streak.Longest = streak.Count
+	}
+	streak.EarnedFreeze = streak.Count%FreezeEarnEvery == 0 && streak.Freezes < MaxStreakFreezes
+	if streak.EarnedFreeze {
+		streak.Freezes++
+	}
+
+	if len(streak.Dates) > maxStreakDates {
+		streak.Dates = streak.Dates[len(streak.Dates)-maxStreakDates:]
+	}
+	if len(streak.FrozenDates) > maxStreakDates {
+		streak.FrozenDates = streak.FrozenDates[len(streak.FrozenDates)-maxStreakDates:]
+	}
+	return streak
+}
+
+// RemoveStreakDay takes back the credit for the day containing at, e.g. when
+// the only judgment that day is undone. Only the latest day can be removed;
+// the longest streak goes back to what it was before the day and freezes
+// spent or earned on it are returned.
+func RemoveStreakDay(streak Streak, at time.Time, loc *time.Location) Streak {
+	day := localMidnight(at, loc)
+	if len(streak.Dates) == 0 || !normaliseStreakDate(streak.Dates[len(streak.Dates)-1], loc).Equal(day) {
+		return streak
+	}
+
+	if streak.EarnedFreeze && streak.Freezes > 0 {
+		streak.Freezes--
+	}
+	streak.Dates = streak.Dates[:len(streak.Dates)-1]
+	streak.Count--
+	if streak.Count < 0 {
+		streak.Count = 0
+	}
+	streak.Longest = max(streak.PrevLongest, streak.Count)
+
+	// What the day before changed isn't kept, so removing it as well leaves
+	// the longest streak and earned freezes alone
+	streak.PrevLongest = streak.Longest
+	streak.EarnedFreeze = false
+
+	// Refund freezes spent bridging the gap to the removed day
+	var previous time.Time
+	if len(streak.Dates) > 0 {
+		previous = normaliseStreakDate(streak.Dates[len(streak.Dates)-1], loc)
+	}
+	for len(streak.FrozenDates) > 0 && streak.FrozenDates[len(streak.FrozenDates)-1].After(previous) {
+		streak.FrozenDates = streak.FrozenDates[:len(streak.FrozenDates)-1]
+		if streak.Freezes < MaxStreakFreezes {
+			streak.Freezes++
+		}
+	}
+	return streak
+}
+
+// CurrentStreak returns the streak to show at now. Today isn't over yet, so
+// a streak last extended yesterday is still alive, as is one whose missed
+// days the player has enough freezes to cover.
+func CurrentStreak(streak Streak, now time.Time, loc *time.Location) int {
+	if len(streak.Dates) == 0 {
+		return 0
+	}
+	last := normaliseStreakDate(streak.Dates[len(streak.Dates)-1], loc)
+	missed := daysBetween(last, localMidnight(now, loc)) - 1
+	if missed > streak.Freezes {
+		return 0
+	}
+	return streak.Count
+}
+
+// LoadLocation returns the named IANA timezone, falling back to UTC for
+// users who haven't set one
+func LoadLocation(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// localMidnight returns the start of the day containing t in loc
+func localMidnight(t time.Time, loc *time.Location) time.Time {
+	year, month, day := t.In(loc).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// normaliseStreakDate converts a stored streak date to a midnight in loc.
+// Dates stored before timezones were supported are UTC midnights and are
+// kept on the same calendar day.
+func normaliseStreakDate(t time.Time, loc *time.Location) time.Time {
+	utc := t.UTC()
+	if _, offset := t.In(loc).Zone(); offset != 0 && utc.Hour() == 0 && utc.Minute() == 0 && utc.Second() == 0 {
+		return time.Date(utc.Year(), utc.Month(), utc.Day(), 0, 0, 0, 0, loc)
+	}
+	return localMidnight(t, loc)
+}
+
+// daysBetween counts calendar days from a to b, ignoring DST changes
+func daysBetween(a, b time.Time) int {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	start := time.Date(ay, am, ad, 0, 0, 0, 0, time.UTC)
+	end := time.Date(by, bm, bd, 0, 0, 0, 0, time.UTC)
+	return int(end.Sub(start).Hours() / 24)
+}
+
+// streak returns the user's stored streak state
+func (u *User) streak() Streak {
+	return Streak{
+		Dates:       u.StreakDates,
+		Count:       u.StreakCount,
+		Longest:     u.LongestStreak,
+		Freezes:     u.StreakFreezes,
+		FrozenDates: u.FrozenDates,
+
+		PrevLongest:  u.PrevLongest,
+		EarnedFreeze: u.EarnedFreeze,
+	}
+}
+
+// setStreak copies streak state back onto the user
+func (u *User) setStreak(streak Streak) {
+	u.StreakDates = streak.Dates
+	u.StreakCount = streak.Count
+	u.LongestStreak = streak.Longest
+	u.StreakFreezes = streak.Freezes
+	u.FrozenDates = streak.FrozenDates
+	u.PrevLongest = streak.PrevLongest
+	u.EarnedFreeze = streak.EarnedFreeze
+}
+
+// SetTimezone sets the IANA timezone the user's streak days are counted in
+func (uc *UserController) SetTimezone(c *gin.Context) {
+	username := c.GetString("username")
+	if username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		Timezone string `json:"timezone" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+		return
+	}
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone", "details": err.Error()})
+		return
+	}
+
+	_, err := uc.collection.UpdateOne(context.Background(), bson.M{"username": username}, bson.M{"$set": bson.M{"timezone": req.Timezone}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update timezone"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Timezone updated",
+		"timezone": req.Timezone,
+	})
+}
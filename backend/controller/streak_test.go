@@ -0,0 +1,276 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+// localTime parses a "2006-01-02 15:04" wall clock time in the named zone
+func localTime(zone, value string) time.Time {
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		panic(err)
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04", value, loc)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// localDay returns the midnight starting a date in the named zone
+func localDay(zone, value string) time.Time {
+	return localTime(zone, value+" 00:00")
+}
+
+// recordDays records activity at each local time in turn
+func recordDays(streak Streak, zone string, times []string) Streak {
+	loc := LoadLocation(zone)
+	for _, value := range times {
+		streak = RecordStreakDay(streak, localTime(zone, value), loc)
+	}
+	return streak
+}
+
+func checkStreak(t *testing.T, got Streak, count, longest, freezes, dates, frozen int) {
+	t.Helper()
+	if got.Count != count || got.Longest != longest || got.Freezes != freezes || len(got.Dates) != dates || len(got.FrozenDates) != frozen {
+		t.Errorf("got count %d, longest %d, freezes %d, %d dates, %d frozen; want %d, %d, %d, %d, %d",
+			got.Count, got.Longest, got.Freezes, len(got.Dates), len(got.FrozenDates),
+			count, longest, freezes, dates, frozen)
+	}
+}
+
+func TestRecordStreakDay(t *testing.T) {
+	tests := []struct {
+		name  string
+		zone  string
+		start Streak
+		times []string // Local times the player is active, in order
+
+		count, longest, freezes, dates, frozen int
+	}{
+		{
+			name:  "first day",
+			zone:  "UTC",
+			times: []string{"2024-05-01 09:00"},
+			count: 1, longest: 1, dates: 1,
+		},
+		{
+			name:  "same day twice",
+			zone:  "America/Los_Angeles",
+			times: []string{"2024-05-01 00:05", "2024-05-01 23:55"},
+			count: 1, longest: 1, dates: 1,
+		},
+		{
+			name:  "same local day across a UTC midnight",
+			zone:  "America/Los_Angeles",
+			times: []string{"2024-05-01 16:00", "2024-05-01 18:00"},
+			count: 1, longest: 1, dates: 1,
+		},
+		{
+			name:  "local midnight starts a new day",
+			zone:  "Asia/Tokyo",
+			times: []string{"2024-05-01 23:59", "2024-05-02 00:01"},
+			count: 2, longest: 2, dates: 2,
+		},
+		{
+			name:  "spring forward",
+			zone:  "America/New_York",
+			times: []string{"2024-03-09 23:30", "2024-03-10 03:30", "2024-03-11 00:30"},
+			count: 3, longest: 3, dates: 3,
+		},
+		{
+			name:  "fall back",
+			zone:  "America/New_York",
+			times: []string{"2024-11-02 22:00", "2024-11-03 01:30", "2024-11-04 00:10"},
+			count: 3, longest: 3, dates: 3,
+		},
+		{
+			name:  "clocks go forward overnight",
+			zone:  "Europe/London",
+			times: []string{"2024-03-30 23:59", "2024-03-31 02:00"},
+			count: 2, longest: 2, dates: 2,
+		},
+		{
+			name:  "southern hemisphere daylight saving ends",
+			zone:  "Australia/Sydney",
+			times: []string{"2024-04-06 23:00", "2024-04-07 23:00"},
+			count: 2, longest: 2, dates: 2,
+		},
+		{
+			name:  "missed day spends a freeze",
+			zone:  "UTC",
+			start: Streak{Dates: []time.Time{localDay("UTC", "2024-05-01")}, Count: 3, Longest: 3, Freezes: 1},
+			times: []string{"2024-05-03 10:00"},
+			count: 4, longest: 4, freezes: 0, dates: 2, frozen: 1,
+		},
+		{
+			name:  "missing more days than freezes resets",
+			zone:  "UTC",
+			start: Streak{Dates: []time.Time{localDay("UTC", "2024-05-01")}, Count: 3, Longest: 3, Freezes: 1},
+			times: []string{"2024-05-04 10:00"},
+			count: 1, longest: 3, freezes: 1, dates: 2,
+		},
+		{
+			name:  "seventh day earns a freeze",
+			zone:  "Europe/Berlin",
+			start: Streak{Dates: []time.Time{localDay("Europe/Berlin", "2024-05-01")}, Count: 6, Longest: 6},
+			times: []string{"2024-05-02 08:00"},
+			count: 7, longest: 7, freezes: 1, dates: 2,
+		},
+		{
+			name:  "banked freezes are capped",
+			zone:  "UTC",
+			start: Streak{Dates: []time.Time{localDay("UTC", "2024-05-01")}, Count: 13, Longest: 13, Freezes: MaxStreakFreezes},
+			times: []string{"2024-05-02 08:00"},
+			count: 14, longest: 14, freezes: MaxStreakFreezes, dates: 2,
+		},
+		{
+			name:  "clock going backwards changes nothing",
+			zone:  "America/Chicago",
+			start: Streak{Dates: []time.Time{localDay("America/Chicago", "2024-05-02")}, Count: 2, Longest: 2},
+			times: []string{"2024-05-01 12:00"},
+			count: 2, longest: 2, dates: 1,
+		},
+		{
+			name:  "legacy UTC midnight stays on its calendar day",
+			zone:  "America/New_York",
+			start: Streak{Dates: []time.Time{localDay("UTC", "2024-05-01")}, Count: 1, Longest: 1},
+			times: []string{"2024-05-02 08:00"},
+			count: 2, longest: 2, dates: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := recordDays(tt.start, tt.zone, tt.times)
+			checkStreak(t, got, tt.count, tt.longest, tt.freezes, tt.dates, tt.frozen)
+		})
+	}
+}
+
+func TestRemoveStreakDay(t *testing.T) {
+	tests := []struct {
+		name   string
+		zone   string
+		start  Streak
+		times  []string // Recorded before the removal
+		remove string
+
+		count, longest, freezes, dates, frozen int
+	}{
+		{
+			name:   "only day",
+			zone:   "UTC",
+			times:  []string{"2024-05-01 09:00"},
+			remove: "2024-05-01 09:00",
+		},
+		{
+			name:   "only the latest day can be removed",
+			zone:   "UTC",
+			times:  []string{"2024-05-01 09:00", "2024-05-02 09:00"},
+			remove: "2024-05-01 10:00",
+			count:  2, longest: 2, dates: 2,
+		},
+		{
+			name:   "day is found in the player's zone",
+			zone:   "America/Los_Angeles",
+			times:  []string{"2024-05-01 09:00", "2024-05-01 20:00"},
+			remove: "2024-05-01 20:00",
+		},
+		{
+			name:   "removing the day after local midnight",
+			zone:   "Asia/Kolkata",
+			times:  []string{"2024-05-01 23:50", "2024-05-02 00:10"},
+			remove: "2024-05-02 00:10",
+			count:  1, longest: 1, dates: 1,
+		},
+		{
+			name:   "across a DST change",
+			zone:   "America/New_York",
+			times:  []string{"2024-03-09 12:00", "2024-03-10 12:00"},
+			remove: "2024-03-10 12:00",
+			count:  1, longest: 1, dates: 1,
+		},
+		{
+			name:   "refunds a spent freeze",
+			zone:   "UTC",
+			start:  Streak{Dates: []time.Time{localDay("UTC", "2024-05-01")}, Count: 3, Longest: 3, Freezes: 1},
+			times:  []string{"2024-05-03 10:00"},
+			remove: "2024-05-03 11:00",
+			count:  3, longest: 3, freezes: 1, dates: 1,
+		},
+		{
+			name:   "takes back a freeze earned that day",
+			zone:   "Europe/Berlin",
+			start:  Streak{Dates: []time.Time{localDay("Europe/Berlin", "2024-05-01")}, Count: 6, Longest: 6},
+			times:  []string{"2024-05-02 08:00"},
+			remove: "2024-05-02 09:00",
+			count:  6, longest: 6, dates: 1,
+		},
+		{
+			name:   "keeps a longest streak reached on an earlier run",
+			zone:   "UTC",
+			start:  Streak{Dates: []time.Time{localDay("UTC", "2024-05-01")}, Count: 4, Longest: 5},
+			times:  []string{"2024-05-02 09:00"},
+			remove: "2024-05-02 09:30",
+			count:  4, longest: 5, dates: 1,
+		},
+		{
+			name:   "keeps freezes banked at the cap",
+			zone:   "UTC",
+			start:  Streak{Dates: []time.Time{localDay("UTC", "2024-05-01")}, Count: 6, Longest: 6, Freezes: MaxStreakFreezes},
+			times:  []string{"2024-05-02 09:00"},
+			remove: "2024-05-02 09:30",
+			count:  6, longest: 6, freezes: MaxStreakFreezes, dates: 1,
+		},
+		{
+			name:   "clock going backwards removes nothing",
+			zone:   "UTC",
+			times:  []string{"2024-05-02 09:00"},
+			remove: "2024-05-01 09:00",
+			count:  1, longest: 1, dates: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streak := recordDays(tt.start, tt.zone, tt.times)
+			got := RemoveStreakDay(streak, localTime(tt.zone, tt.remove), LoadLocation(tt.zone))
+			checkStreak(t, got, tt.count, tt.longest, tt.freezes, tt.dates, tt.frozen)
+		})
+	}
+}
+
+func TestCurrentStreak(t *testing.T) {
+	tests := []struct {
+		name    string
+		zone    string
+		last    string // Latest active day
+		now     string
+		freezes int
+		want    int
+	}{
+		{name: "active today", zone: "UTC", last: "2024-05-02", now: "2024-05-02 23:00", want: 5},
+		{name: "active yesterday", zone: "UTC", last: "2024-05-01", now: "2024-05-02 23:59", want: 5},
+		{name: "missed a day", zone: "UTC", last: "2024-05-01", now: "2024-05-03 00:00", want: 0},
+		{name: "missed day covered by a freeze", zone: "UTC", last: "2024-05-01", now: "2024-05-03 12:00", freezes: 1, want: 5},
+		{name: "before local midnight", zone: "Asia/Tokyo", last: "2024-05-01", now: "2024-05-02 23:30", want: 5},
+		{name: "after local midnight", zone: "Asia/Tokyo", last: "2024-05-01", now: "2024-05-03 00:30", want: 0},
+		{name: "west of UTC after UTC midnight", zone: "America/Denver", last: "2024-05-01", now: "2024-05-02 21:00", want: 5},
+		{name: "across spring forward", zone: "America/New_York", last: "2024-03-09", now: "2024-03-10 23:00", want: 5},
+		{name: "across fall back", zone: "Europe/Paris", last: "2024-10-26", now: "2024-10-27 23:30", want: 5},
+		{name: "clock behind the latest day", zone: "UTC", last: "2024-05-03", now: "2024-05-01 12:00", want: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streak := Streak{Dates: []time.Time{localDay(tt.zone, tt.last)}, Count: 5, Longest: 5, Freezes: tt.freezes}
+			if got := CurrentStreak(streak, localTime(tt.zone, tt.now), LoadLocation(tt.zone)); got != tt.want {
+				t.Errorf("CurrentStreak = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if got := CurrentStreak(Streak{}, time.Now(), time.UTC); got != 0 {
+		t.Errorf("CurrentStreak with no days = %d, want 0", got)
+	}
+}
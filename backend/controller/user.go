@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/dwu006/aita/db"
@@ -12,7 +13,6 @@ import (
 	"github.com/golang-jwt/jwt/v4"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -25,10 +25,32 @@ type User struct {
 	NumPosts    int               `json:"num_posts" bson:"num_posts"`
 	FavCategory string            `json:"fav_category" bson:"fav_category"`
 	Accuracy    float64           `json:"accuracy" bson:"accuracy"`
-	PFP         string            `json:"pfp" bson:"pfp"` // URL or base64 encoded image
+	PFP         string            `json:"pfp" bson:"pfp"`                   // URL or base64 encoded image
 	PostHistory map[string]string `json:"post_history" bson:"post_history"` // Map of post_id to judgment
 	StreakDates []time.Time       `json:"streak_dates" bson:"streak_dates"`
 	StreakCount int               `json:"streak_count" bson:"streak_count"`
+
+	Timezone         string                   `json:"timezone" bson:"timezone,omitempty"` // IANA name, streak days are counted in this zone
+	StreakFreezes    int                      `json:"streak_freezes" bson:"streak_freezes"`
+	LongestStreak    int                      `json:"longest_streak" bson:"longest_streak"`
+	TotalActiveDays  int                      `json:"total_active_days" bson:"total_active_days"`
+	ScoredJudgments  int                      `json:"scored_judgments" bson:"scored_judgments"` // Judgments on posts with a community verdict
+	CorrectJudgments int                      `json:"correct_judgments" bson:"correct_judgments"`
+	ContrarianWins   int                      `json:"contrarian_wins" bson:"contrarian_wins"`
+	XP               int                      `json:"xp" bson:"xp"`
+	Level            int                      `json:"level" bson:"level"`
+	Rating           *Rating                  `json:"rating,omitempty" bson:"rating,omitempty"` // Glicko-2 skill rating, unset until a judgment is scored
+	Duels            DuelRecord               `json:"duels" bson:"duels"`
+	FrozenDates      []time.Time              `json:"frozen_dates,omitempty" bson:"frozen_dates,omitempty"`     // Missed days covered by a freeze
+	PrevLongest      int                      `json:"-" bson:"prev_longest_streak,omitempty"`                   // Longest streak before the latest active day
+	EarnedFreeze     bool                     `json:"-" bson:"earned_freeze,omitempty"`                         // Whether the latest active day earned a freeze
+	HistoryTags      map[string][]string      `json:"history_tags,omitempty" bson:"history_tags,omitempty"`     // Map of post_id to the post's category tags
+	CategoryStats    map[string]CategoryStats `json:"category_stats,omitempty" bson:"category_stats,omitempty"` // Keyed by category
+
+	// Stored for the lifetime leaderboards to sort on
+	OverallScore       float64 `json:"-" bson:"overall_score"`
+	AccuracyScore      float64 `json:"-" bson:"accuracy_score"` // Wilson lower bound of accuracy
+	ConservativeRating float64 `json:"-" bson:"conservative_rating"`
 }
 
 // UserLogin represents the login request body
@@ -42,20 +64,65 @@ type UserRegister struct {
 	Username string `json:"username" binding:"required"`
 	Name     string `json:"name" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	Timezone string `json:"timezone"` // Optional IANA timezone, e.g. "America/New_York"
 }
 
 // UserController handles user-related operations
 type UserController struct {
-	collection *mongo.Collection
-	jwtSecret  []byte
+	collection         *mongo.Collection
+	posts              *mongo.Collection
+	judgments          *mongo.Collection
+	activity           *mongo.Collection
+	achievements       *mongo.Collection
+	dailyChallenges    *mongo.Collection
+	dailyAttempts      *mongo.Collection
+	leaderboardArchive *mongo.Collection
+	follows            *mongo.Collection
+	duels              *mongo.Collection
+	eligibility        EligibilityRules // Who can be ranked by accuracy
+	jwtSecret          []byte
+	admins             map[string]bool
+	now                func() time.Time // Clock, replaceable for tests and backfills
 }
 
 // NewUserController creates a new UserController instance
-func NewUserController(jwtSecret string) *UserController {
-	return &UserController{
-		collection: db.GetDB().Collection("users"),
-		jwtSecret:  []byte(jwtSecret),
+func NewUserController(jwtSecret string, adminUsernames []string) *UserController {
+	admins := make(map[string]bool)
+	for _, name := range adminUsernames {
+		if name = strings.TrimSpace(name); name != "" {
+			admins[name] = true
+		}
 	}
+
+	uc := &UserController{
+		collection:         db.GetDB().Collection("users"),
+		posts:              db.GetDB().Collection("posts"),
+		judgments:          db.GetDB().Collection("judgments"),
+		activity:           db.GetDB().Collection("activity"),
+		achievements:       db.GetDB().Collection("achievements"),
+		dailyChallenges:    db.GetDB().Collection("daily_challenges"),
+		dailyAttempts:      db.GetDB().Collection("daily_attempts"),
+		leaderboardArchive: db.GetDB().Collection("leaderboard_archive"),
+		follows:            db.GetDB().Collection("follows"),
+		duels:              db.GetDB().Collection("duels"),
+		eligibility:        DefaultEligibilityRules,
+		jwtSecret:          []byte(jwtSecret),
+		admins:             admins,
+		now:                time.Now,
+	}
+	uc.createJudgmentIndexes()
+	uc.createActivityIndexes()
+	uc.createAchievementIndexes()
+	uc.createDailyIndexes()
+	uc.createLeaderboardIndexes()
+	uc.createFollowIndexes()
+	uc.createDuelIndexes()
+	return uc
+}
+
+// SetClock replaces the clock used for judgment times and streak days
+func (uc *UserController) SetClock(now func() time.Time) {
+	uc.now = now
 }
 
 // Register creates a new user account
@@ -84,6 +151,13 @@ func (uc *UserController) Register(c *gin.Context) {
 		return
 	}
 
+	if userRegister.Timezone != "" {
+		if _, err := time.LoadLocation(userRegister.Timezone); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid timezone"})
+			return
+		}
+	}
+
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(userRegister.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -104,7 +178,9 @@ func (uc *UserController) Register(c *gin.Context) {
 		PostHistory: make(map[string]string),
 		StreakDates: []time.Time{},
 		StreakCount: 0,
+		Timezone:    userRegister.Timezone,
 	}
+	newUser.leaderboardScores()
 
 	_, err = uc.collection.InsertOne(context.Background(), newUser)
 	if err != nil {
@@ -247,7 +323,15 @@ func (uc *UserController) FetchUser(c *gin.Context) {
 			"pfp":          user.PFP,
 			"post_history": user.PostHistory,
 			"streak_dates": user.StreakDates,
-			"streak_count": user.StreakCount,
+			"streak_count": CurrentStreak(user.streak(), uc.now(), LoadLocation(user.Timezone)),
+			"streak_freezes": user.StreakFreezes,
+			"longest_streak": user.LongestStreak,
+			"total_active_days": user.TotalActiveDays,
+			"timezone":     user.Timezone,
+			"category_stats": user.CategoryStats,
+			"xp":           user.XP,
+			"level":        LevelForXP(user.XP),
+			"rating":       user.rating(),
 		},
 	})
 }
@@ -406,8 +490,10 @@ func (uc *UserController) AddPostToHistory(c *gin.Context) {
 
 	// Parse request body
 	var req struct {
-		PostID   string `json:"post_id" binding:"required"`
-		Judgment string `json:"judgment" binding:"required"`
+		PostID    string `json:"post_id" binding:"required"`
+		Judgment  string `json:"judgment" binding:"required"`
+		LatencyMs int64  `json:"latency_ms"` // Optional, how long the user took to decide
+		Source    string `json:"source"`     // Optional, defaults to the main feed
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -433,67 +519,51 @@ func (uc *UserController) AddPostToHistory(c *gin.Context) {
 		return
 	}
 
-	// Initialize post history map if it doesn't exist
-	if user.PostHistory == nil {
-		user.PostHistory = make(map[string]string)
+	if req.Source == "" {
+		req.Source = SourceFeed
 	}
 
-	// Add the post to history
-	user.PostHistory[req.PostID] = req.Judgment
-
-	// Update NumPosts count
-	user.NumPosts = len(user.PostHistory)
-
-	// Update streak information
-	today := time.Now().Truncate(24 * time.Hour)
-	
-	// Check if already swiped today
-	alreadySwipedToday := false
-	for _, date := range user.StreakDates {
-		if date.Truncate(24 * time.Hour).Equal(today) {
-			alreadySwipedToday = true
-			break
-		}
+	// Record the judgment with the post's community verdict. Judging the same
+	// post again changes the existing answer instead of counting twice.
+	judgment, previous, err := uc.recordJudgment(context.Background(), user.Username, req.PostID, req.Judgment, req.LatencyMs, req.Source)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record judgment", "details": err.Error()})
+		return
 	}
-	
-	// If not swiped today, add to streak
-	if !alreadySwipedToday {
-		user.StreakDates = append(user.StreakDates, today)
-		
-		// Check if streak is continuous by looking at yesterday
-		yesterday := today.Add(-24 * time.Hour)
-		hadSwipeYesterday := false
-		
-		for _, date := range user.StreakDates {
-			if date.Truncate(24 * time.Hour).Equal(yesterday) {
-				hadSwipeYesterday = true
-				break
-			}
-		}
-		
-		if hadSwipeYesterday || len(user.StreakDates) == 1 {
-			// Either this is the first swipe ever or we swiped yesterday too
-			user.StreakCount++
-		} else {
-			// Streak broken
-			user.StreakCount = 1
+	isNew := previous == nil
+
+	// Update streak information and the activity log, counting days in the
+	// user's timezone. Changing an earlier answer doesn't count as activity.
+	loc := LoadLocation(user.Timezone)
+	newDay := false
+	if isNew {
+		user.setStreak(RecordStreakDay(user.streak(), judgment.CreatedAt, loc))
+		if newDay, err = uc.recordActivity(context.Background(), user.Username, judgment.CreatedAt, loc); err != nil {
+			fmt.Println("Failed to record activity:", err)
 		}
-	}
 
-	// Limit streak dates history to last 30 days to keep the array size manageable
-	if len(user.StreakDates) > 30 {
-		user.StreakDates = user.StreakDates[len(user.StreakDates)-30:]
+		// XP is boosted by the streak the judgment was made on
+		judgment.Streak = user.StreakCount
+		if _, err := uc.judgments.UpdateOne(context.Background(), bson.M{"_id": judgment.ID}, bson.M{"$set": bson.M{"streak": judgment.Streak}}); err != nil {
+			fmt.Println("Failed to record judgment streak:", err)
+		}
 	}
 
 	// Update the user in the database
 	update := bson.M{
 		"$set": bson.M{
-			"post_history":  user.PostHistory,
-			"num_posts":     user.NumPosts,
-			"streak_dates":  user.StreakDates,
-			"streak_count":  user.StreakCount,
+			"streak_dates":        user.StreakDates,
+			"streak_count":        user.StreakCount,
+			"longest_streak":      user.LongestStreak,
+			"streak_freezes":      user.StreakFreezes,
+			"frozen_dates":        user.FrozenDates,
+			"prev_longest_streak": user.PrevLongest,
+			"earned_freeze":       user.EarnedFreeze,
 		},
 	}
+	if newDay {
+		update["$inc"] = bson.M{"total_active_days": 1}
+	}
 
 	_, err = uc.collection.UpdateOne(
 		context.Background(),
@@ -506,89 +576,57 @@ func (uc *UserController) AddPostToHistory(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Post added to history",
-		"num_posts": user.NumPosts,
-		"streak_count": user.StreakCount,
-	})
-}
-
-// GetLeaderboard retrieves user rankings sorted by specified criteria
-func (uc *UserController) GetLeaderboard(c *gin.Context) {
-	// Get the sort criteria from query parameter
-	sortBy := c.DefaultQuery("sort", "overall")
-	
-	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	
-	// Find all users (excluding password field)
-	cursor, err := uc.collection.Find(
-		ctx,
-		bson.M{}, // No filter, get all users
-		options.Find().SetProjection(bson.M{
-			"username": 1,
-			"name": 1,
-			"num_posts": 1,
-			"accuracy": 1,
-			"pfp": 1,
-			"_id": 1,
-		}),
-	)
-	
+	// Post history, counts, accuracy and categories all follow the judgment
+	stats, err := uc.applyJudgmentStats(context.Background(), user.Username, previous, judgment)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users", "details": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user stats", "details": err.Error()})
 		return
 	}
-	defer cursor.Close(ctx)
-	
-	// Decode all users
-	var users []User
-	if err := cursor.All(ctx, &users); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode users", "details": err.Error()})
-		return
+
+	// The answer counts towards how hard the post is for everyone else
+	if err := refreshDifficulty(context.Background(), uc.posts, uc.judgments, judgment.PostID); err != nil {
+		fmt.Println("Failed to update post difficulty:", err)
 	}
-	
-	// Sort users based on criteria
-	switch sortBy {
-	case "accuracy":
-		// Sort by accuracy (highest first)
-		for i := 0; i < len(users)-1; i++ {
-			for j := i + 1; j < len(users); j++ {
-				if users[i].Accuracy < users[j].Accuracy {
-					users[i], users[j] = users[j], users[i]
-				}
-			}
-		}
-	case "num_posts":
-		// Sort by number of posts judged (highest first)
-		for i := 0; i < len(users)-1; i++ {
-			for j := i + 1; j < len(users); j++ {
-				if users[i].NumPosts < users[j].NumPosts {
-					users[i], users[j] = users[j], users[i]
-				}
-			}
+
+	// A scored judgment is a game between the player and the post. Changing
+	// the scored answer inside the undo window replaces its earlier result.
+	rescored := !isNew && judgment != previous && judgment.Revisions[len(judgment.Revisions)-1].Scored
+	if isNew || rescored {
+		if err := uc.rateJudgment(context.Background(), stats, judgment); err != nil {
+			fmt.Println("Failed to update rating:", err)
 		}
-	default: // "overall" or any other value
-		// Sort by a weighted combination of accuracy and posts
-		for i := 0; i < len(users)-1; i++ {
-			for j := i + 1; j < len(users); j++ {
-				// Calculate overall score (70% accuracy, 30% posts)
-				scoreI := users[i].Accuracy*0.7 + float64(users[i].NumPosts)*0.3/5
-				scoreJ := users[j].Accuracy*0.7 + float64(users[j].NumPosts)*0.3/5
-				if scoreI < scoreJ {
-					users[i], users[j] = users[j], users[i]
-				}
-			}
+	}
+
+	// Unlock any achievements this judgment completed
+	unlocked := []Achievement{}
+	if isNew {
+		if unlocked, err = uc.onJudgment(context.Background(), stats, judgment); err != nil {
+			fmt.Println("Failed to check achievements:", err)
 		}
 	}
-	
-	// Limit to top 50 users for performance
-	if len(users) > 50 {
-		users = users[:50]
+
+	// The answer stays hidden while it can still be changed or the post is in
+	// play, including the correct bonus in the XP it earned
+	shown := []Judgment{judgment.forResponse(uc.now())}
+	if err := uc.withholdJudgments(context.Background(), shown); err != nil {
+		fmt.Println("Failed to check posts in play:", err)
+		shown[0] = shown[0].hideAnswer()
 	}
-	
-	c.JSON(http.StatusOK, users)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Post added to history",
+		"num_posts": stats.NumPosts,
+		"streak_count": user.StreakCount,
+		"streak_freezes": user.StreakFreezes,
+		"longest_streak": user.LongestStreak,
+		"fav_category": stats.FavCategory,
+		"judgment": shown[0],
+		"undo_until": judgment.UndoUntil(),
+		"achievements_unlocked": unlocked,
+		"xp_gained": shown[0].XP(),
+		"xp": stats.XP,
+		"level": LevelForXP(stats.XP),
+		"rating": stats.rating(),
+	})
 }
 
 // UpdateUserStats updates a user's stats such as accuracy and post count
@@ -635,6 +673,17 @@ func (uc *UserController) UpdateUserStats(c *gin.Context) {
 		return
 	}
 
+	// Stats derived from recorded judgments take precedence over what the
+	// client reports, once the server can score them
+	if len(user.PostHistory) > 0 {
+		if req.NumPosts != nil {
+			req.NumPosts = &user.NumPosts
+		}
+		if req.Accuracy != nil && user.ScoredJudgments > 0 {
+			req.Accuracy = &user.Accuracy
+		}
+	}
+
 	// Build update object only with provided fields
 	updateFields := bson.M{}
 	
@@ -645,6 +694,16 @@ func (uc *UserController) UpdateUserStats(c *gin.Context) {
 	if req.Accuracy != nil {
 		updateFields["accuracy"] = *req.Accuracy
 	}
+
+	// Keep the overall leaderboard score in line with the reported stats
+	if req.NumPosts != nil {
+		user.NumPosts = *req.NumPosts
+	}
+	if req.Accuracy != nil {
+		user.Accuracy = *req.Accuracy
+	}
+	user.leaderboardScores()
+	updateFields["overall_score"] = user.OverallScore
 	
 	// Create update document
 	update := bson.M{
@@ -663,42 +722,6 @@ func (uc *UserController) UpdateUserStats(c *gin.Context) {
 		return
 	}
 
-	// Only update favorite category if we have post history
-	if req.NumPosts != nil && user.PostHistory != nil && len(user.PostHistory) > 0 {
-		categoryMap := make(map[string]int)
-		
-		// This is a simplification. In a real app, you'd track categories per post
-		// Here we're just updating the fav_category field if we have post history data
-		for _, judgment := range user.PostHistory {
-			if judgment != "" {
-				categoryMap[judgment]++
-			}
-		}
-		
-		// Find most frequent category
-		var maxCount int
-		var favCategory string
-		for cat, count := range categoryMap {
-			if count > maxCount {
-				maxCount = count
-				favCategory = cat
-			}
-		}
-		
-		if favCategory != "" {
-			_, err = uc.collection.UpdateOne(
-				context.Background(),
-				bson.M{"username": username},
-				bson.M{"$set": bson.M{"fav_category": favCategory}},
-			)
-			
-			if err != nil {
-				// Just log the error but continue
-				fmt.Println("Failed to update favorite category:", err)
-			}
-		}
-	}
-
 	// Build response with updated fields
 	response := gin.H{"message": "Stats updated successfully"}
 	if req.NumPosts != nil {
@@ -806,6 +829,14 @@ func (uc *UserController) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get token from Authorization header
 		authHeader := c.GetHeader("Authorization")
+		// Browsers can't set headers on WebSocket connections, so those pass
+		// the token as a subprotocol instead. A query parameter would end up
+		// in the request log.
+		if authHeader == "" && strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+			if token, ok := webSocketToken(c.GetHeader("Sec-WebSocket-Protocol")); ok {
+				authHeader = "Bearer " + token
+			}
+		}
 		if authHeader == "" {
 			c.JSON(401, gin.H{"error": "Authorization header is required"})
 			c.Abort()
@@ -856,3 +887,16 @@ func (uc *UserController) AuthMiddleware() gin.HandlerFunc {
 		}
 	}
 }
+
+
+// AdminMiddleware only lets configured admin users through. It must run after AuthMiddleware.
+func (uc *UserController) AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !uc.admins[c.GetString("username")] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
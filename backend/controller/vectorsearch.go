@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"context"
+	"sort"
+
+	"github.com/dwu006/aita/api"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxVectorCandidates bounds how many stored vectors are compared in memory
+// for a provider without a vector search index. Only the most recently
+// embedded posts are searched, which is where reposts turn up.
+const MaxVectorCandidates = 2000
+
+// vectorSearchCandidates is how many candidates per result an Atlas vector
+// search considers before ranking
+const vectorSearchCandidates = 20
+
+// scoredPost is a post and its cosine similarity to a query vector
+type scoredPost struct {
+	postID     string
+	similarity float64
+}
+
+// SetVectorIndexes makes similarity searches use Atlas vector search. It maps
+// provider names to index names. Each index is a "vectorSearch" index on the
+// post_embeddings collection with "vector" as a cosine vector field of the
+// provider's dimensions and "provider" as a filter field.
+func (pc *PostCatalog) SetVectorIndexes(indexes map[string]string) {
+	pc.vectorIndexes = indexes
+}
+
+// nearestPosts returns up to limit posts whose provider vectors are closest
+// to vector, most similar first, skipping excludeID
+func (pc *PostCatalog) nearestPosts(ctx context.Context, provider string, vector []float32, excludeID string, limit int) ([]scoredPost, error) {
+	if index, ok := pc.vectorIndexes[provider]; ok {
+		return pc.vectorSearch(ctx, index, provider, vector, excludeID, limit)
+	}
+
+	cursor, err := pc.embeddings.Find(ctx,
+		bson.M{"provider": provider, "post_id": bson.M{"$ne": excludeID}},
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}}).
+			SetLimit(MaxVectorCandidates).
+			SetProjection(bson.M{"post_id": 1, "vector": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var candidates []scoredPost
+	for cursor.Next(ctx) {
+		var embedding PostEmbedding
+		if err := cursor.Decode(&embedding); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, scoredPost{embedding.PostID, api.CosineSimilarity(vector, embedding.Vector)})
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].similarity > candidates[j].similarity
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates, nil
+}
+
+// vectorSearch asks an Atlas vector search index for the nearest posts
+func (pc *PostCatalog) vectorSearch(ctx context.Context, index, provider string, vector []float32, excludeID string, limit int) ([]scoredPost, error) {
+	cursor, err := pc.embeddings.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$vectorSearch", Value: bson.M{
+			"index":         index,
+			"path":          "vector",
+			"queryVector":   vector,
+			"numCandidates": (limit + 1) * vectorSearchCandidates,
+			"limit":         limit + 1, // The excluded post may be among them
+			"filter":        bson.M{"provider": provider},
+		}}},
+		{{Key: "$match", Value: bson.M{"post_id": bson.M{"$ne": excludeID}}}},
+		{{Key: "$limit", Value: limit}},
+		{{Key: "$project", Value: bson.M{"post_id": 1, "score": bson.M{"$meta": "vectorSearchScore"}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var found []struct {
+		PostID string  `bson:"post_id"`
+		Score  float64 `bson:"score"`
+	}
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	// Atlas scales cosine similarity to between 0 and 1
+	results := make([]scoredPost, len(found))
+	for i, result := range found {
+		results[i] = scoredPost{result.PostID, 2*result.Score - 1}
+	}
+	return results, nil
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Verdicts used on r/AmItheAsshole
+const (
+	VerdictYTA  = "YTA"  // You're the asshole
+	VerdictNTA  = "NTA"  // Not the asshole
+	VerdictESH  = "ESH"  // Everyone sucks here
+	VerdictNAH  = "NAH"  // No assholes here
+	VerdictINFO = "INFO" // Not enough info
+)
+
+// commentVerdictPattern matches YTA, NTA and ESH in any case, but NAH and INFO
+// only in uppercase, since "nah" and "info" are ordinary words that don't cast
+// a vote
+var commentVerdictPattern = regexp.MustCompile(`\b((?i:YTA|NTA|ESH)|NAH|INFO)\b`)
+
+// ClassifyVerdict returns the first verdict a comment votes for, or an empty
+// string if the comment doesn't vote
+func ClassifyVerdict(comment string) string {
+	return strings.ToUpper(commentVerdictPattern.FindString(comment))
+}
+
+// CountVerdicts tallies the verdicts voted for in a list of comments
+func CountVerdicts(comments []string) map[string]int {
+	counts := make(map[string]int)
+	for _, comment := range comments {
+		if verdict := ClassifyVerdict(comment); verdict != "" {
+			counts[verdict]++
+		}
+	}
+	return counts
+}
+
+// CommunityVerdict returns the verdict with the most votes, ignoring INFO.
+// Ties and posts without votes return an empty string.
+func CommunityVerdict(counts map[string]int) string {
+	best, winner, tied := 0, "", false
+	for _, verdict := range []string{VerdictYTA, VerdictNTA, VerdictESH, VerdictNAH} {
+		switch count := counts[verdict]; {
+		case count > best:
+			best, winner, tied = count, verdict, false
+		case count == best && count > 0:
+			tied = true
+		}
+	}
+	if tied {
+		return ""
+	}
+	return winner
+}
+
+// VerdictSide collapses a verdict to the YTA/NTA choice players make:
+// everyone sucking still makes the poster an asshole, and no assholes means
+// the poster isn't one
+func VerdictSide(verdict string) string {
+	switch verdict {
+	case VerdictYTA, VerdictESH:
+		return VerdictYTA
+	case VerdictNTA, VerdictNAH:
+		return VerdictNTA
+	default:
+		return ""
+	}
+}
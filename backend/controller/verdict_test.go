@@ -0,0 +1,49 @@
+package controller
+
+import "testing"
+
+func TestClassifyVerdict(t *testing.T) {
+	tests := []struct {
+		comment string
+		want    string
+	}{
+		{"NTA, your sister is out of line", VerdictNTA},
+		{"YTA. Apologize.", VerdictYTA},
+		{"Honestly ESH here", VerdictESH},
+		{"NAH, just a misunderstanding", VerdictNAH},
+		{"INFO: how old is the kid?", VerdictINFO},
+		{"NTA but also YTA for the follow-up", VerdictNTA},
+		{"nah, that's not how it works", ""},
+		{"Nah man", ""},
+		{"need more info before I decide", ""},
+		{"Info would help here", ""},
+		{"nta", VerdictNTA},
+		{"yta, obviously", VerdictYTA},
+		{"Esh. Both of you", VerdictESH},
+		{"nah man, nta", VerdictNTA},
+		{"NTAs everywhere", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ClassifyVerdict(tt.comment); got != tt.want {
+			t.Errorf("ClassifyVerdict(%q) = %q, want %q", tt.comment, got, tt.want)
+		}
+	}
+}
+
+func TestCountVerdictsIgnoresOrdinaryWords(t *testing.T) {
+	counts := CountVerdicts([]string{
+		"NTA",
+		"nah, you're fine",
+		"nta",
+		"Not enough info",
+		"YTA",
+		"NTA obviously",
+	})
+	if counts[VerdictNTA] != 3 || counts[VerdictYTA] != 1 || counts[VerdictNAH] != 0 || counts[VerdictINFO] != 0 {
+		t.Errorf("CountVerdicts = %v", counts)
+	}
+	if got := CommunityVerdict(counts); got != VerdictNTA {
+		t.Errorf("CommunityVerdict = %q, want NTA", got)
+	}
+}
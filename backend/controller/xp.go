@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// XP rules
+const (
+	BaseXP            = 10 // Every judgment
+	CorrectBonusXP    = 15 // Extra for matching the community, scaled up on harder posts
+	MaxStreakBonus    = 1.0
+	StreakBonusPerDay = 0.05 // A 20 day streak doubles XP
+
+	// FullBonusDifficulty is the difficulty that doubles the correct bonus. A
+	// comment split can't rate a post harder than a coin flip, so anything
+	// from 0.5 up gets the whole range.
+	FullBonusDifficulty = 0.5
+)
+
+// LevelXPStep sets how fast levels get further apart: reaching level n takes
+// LevelXPStep * n * (n-1) / 2 XP in total, so level 2 is 100 XP, level 3 is
+// 300, level 4 is 600 and so on
+const LevelXPStep = 100
+
+// Level is a player's level and how far they are through it
+type Level struct {
+	Level     int `json:"level"`
+	XP        int `json:"xp"`
+	LevelXP   int `json:"level_xp"`   // Total XP the current level started at
+	NextLevel int `json:"next_level"` // Total XP needed for the next level
+}
+
+// StreakMultiplier returns how much a judgment made on the given streak day
+// is boosted
+func StreakMultiplier(streak int) float64 {
+	if streak <= 1 {
+		return 1
+	}
+	return 1 + math.Min(float64(streak-1)*StreakBonusPerDay, MaxStreakBonus)
+}
+
+// JudgmentXP returns the XP a judgment is worth. correct is nil until the
+// post has a community verdict, difficulty is from 0 to 1 and streak is the
+// player's streak on the day they judged.
+func JudgmentXP(correct *bool, difficulty float64, streak int) int {
+	xp := float64(BaseXP)
+	if correct != nil && *correct {
+		xp += CorrectBonusXP * (1 + math.Min(difficulty/FullBonusDifficulty, 1))
+	}
+	return int(math.Round(xp * StreakMultiplier(streak)))
+}
+
+// XP returns what the judgment is worth
+func (j *Judgment) XP() int {
+	return JudgmentXP(j.Correct, j.Difficulty, j.Streak)
+}
+
+// LevelXP returns the total XP needed to reach a level
+func LevelXP(level int) int {
+	if level <= 1 {
+		return 0
+	}
+	return LevelXPStep * level * (level - 1) / 2
+}
+
+// LevelForXP returns the level a player with the given total XP is on
+func LevelForXP(xp int) Level {
+	level := 1
+	for LevelXP(level+1) <= xp {
+		level++
+	}
+	return Level{
+		Level:     level,
+		XP:        xp,
+		LevelXP:   LevelXP(level),
+		NextLevel: LevelXP(level + 1),
+	}
+}
+
+// TotalXP adds up the XP of a set of judgments
+func TotalXP(judgments []Judgment) int {
+	total := 0
+	for i := range judgments {
+		total += judgments[i].XP()
+	}
+	return total
+}
+
+// RecalculateXP replays every user's judgments in order to work out the
+// streak each was made on, rescores each judgment's difficulty from the post
+// without the player's own answer and then recalculates their XP and level.
+// Migrated judgments count without a streak bonus because their real dates
+// weren't recorded.
+func (uc *UserController) RecalculateXP(ctx context.Context) (int, error) {
+	cursor, err := uc.collection.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"username": 1, "timezone": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	recalculated := 0
+	for cursor.Next(ctx) {
+		var user User
+		if err := cursor.Decode(&user); err != nil {
+			return recalculated, err
+		}
+		if err := uc.replayJudgmentStreaks(ctx, user); err != nil {
+			return recalculated, err
+		}
+		if _, err := uc.recalculateStats(ctx, user.Username); err != nil {
+			return recalculated, err
+		}
+		recalculated++
+	}
+	return recalculated, cursor.Err()
+}
+
+// replayJudgmentStreaks sets the streak and difficulty stored on each of the
+// user's judgments
+func (uc *UserController) replayJudgmentStreaks(ctx context.Context, user User) error {
+	cursor, err := uc.judgments.Find(ctx, bson.M{"username": user.Username, "undone_at": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	var judgments []Judgment
+	if err := cursor.All(ctx, &judgments); err != nil {
+		return err
+	}
+	sort.SliceStable(judgments, func(i, j int) bool {
+		return judgments[i].CreatedAt.Before(judgments[j].CreatedAt)
+	})
+
+	ids := make([]string, len(judgments))
+	for i, judgment := range judgments {
+		ids[i] = judgment.PostID
+	}
+	posts, err := uc.posts.Find(ctx,
+		bson.M{"post_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"comments": 0, "selftext": 0}),
+	)
+	if err != nil {
+		return err
+	}
+	var found []Post
+	if err := posts.All(ctx, &found); err != nil {
+		return err
+	}
+	postsByID := make(map[string]Post, len(found))
+	for _, post := range found {
+		postsByID[post.PostID] = post
+	}
+
+	loc := LoadLocation(user.Timezone)
+	var streak Streak
+	for i := range judgments {
+		judgment := &judgments[i]
+		if post, ok := postsByID[judgment.PostID]; ok {
+			judgment.applyPost(post)
+			judgment.Difficulty = difficultyWithout(post, judgment)
+		} else {
+			judgment.Difficulty = EstimateDifficulty(nil, 0, 0).Score
+		}
+		judgment.Streak = 0
+		if judgment.Source != SourceMigration {
+			streak = RecordStreakDay(streak, judgment.CreatedAt, loc)
+			judgment.Streak = streak.Count
+		}
+
+		set := bson.M{
+			"subreddit":         judgment.Subreddit,
+			"tags":              judgment.Tags,
+			"community_verdict": judgment.CommunityVerdict,
+			"difficulty":        judgment.Difficulty,
+			"streak":            judgment.Streak,
+		}
+		if judgment.Correct != nil {
+			set["correct"] = *judgment.Correct
+		}
+		if _, err := uc.judgments.UpdateOne(ctx, bson.M{"_id": judgment.ID}, bson.M{"$set": set}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package evaluation
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Example is one labelled post from a JSONL fixture. Each line looks like:
+//
+//	{"id": "abc123", "title": "AITA for ...", "body": "...", "verdict": "NTA"}
+//
+// where verdict is the post's final flair (YTA, NTA, ESH or NAH).
+type Example struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	Verdict string `json:"verdict"`
+}
+
+var validLabels = map[string]bool{"YTA": true, "NTA": true, "ESH": true, "NAH": true}
+
+// LoadDataset reads a JSONL fixture, skipping blank lines
+func LoadDataset(path string) ([]Example, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var examples []Example
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 10*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var example Example
+		if err := json.Unmarshal([]byte(text), &example); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		example.Verdict = strings.ToUpper(strings.TrimSpace(example.Verdict))
+		if !validLabels[example.Verdict] {
+			return nil, fmt.Errorf("line %d: unknown verdict %q", line, example.Verdict)
+		}
+		examples = append(examples, example)
+	}
+	return examples, scanner.Err()
+}
@@ -0,0 +1,149 @@
+package evaluation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Unparsed is the predicted label for responses without a recognisable verdict
+const Unparsed = "UNPARSED"
+
+// Prediction is the judge's answer for one example
+type Prediction struct {
+	ExampleID string `json:"id"`
+	Expected  string `json:"expected"`
+	Predicted string `json:"predicted"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ClassMetrics holds precision and recall for one verdict
+type ClassMetrics struct {
+	Support   int     `json:"support"` // Examples whose true label is this class
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	F1        float64 `json:"f1"`
+}
+
+// Report summarises how one judge variant did on the dataset
+type Report struct {
+	Variant   string                    `json:"variant"`
+	Total     int                       `json:"total"`
+	Errors    int                       `json:"errors"` // Calls that failed outright
+	Correct   int                       `json:"correct"`
+	Accuracy  float64                   `json:"accuracy"` // Over every example, failures count as wrong
+	PerClass  map[string]ClassMetrics   `json:"per_class"`
+	Confusion map[string]map[string]int `json:"confusion"` // expected -> predicted -> count
+}
+
+// Evaluate computes accuracy, per-class precision/recall and a confusion matrix
+func Evaluate(variant string, predictions []Prediction) Report {
+	report := Report{
+		Variant:   variant,
+		Total:     len(predictions),
+		PerClass:  make(map[string]ClassMetrics),
+		Confusion: make(map[string]map[string]int),
+	}
+
+	predictedCounts := make(map[string]int)
+	for _, p := range predictions {
+		if p.Error != "" {
+			report.Errors++
+		}
+		predicted := p.Predicted
+		if predicted == "" {
+			predicted = Unparsed
+		}
+		if report.Confusion[p.Expected] == nil {
+			report.Confusion[p.Expected] = make(map[string]int)
+		}
+		report.Confusion[p.Expected][predicted]++
+		predictedCounts[predicted]++
+		if predicted == p.Expected {
+			report.Correct++
+		}
+	}
+	if report.Total > 0 {
+		report.Accuracy = float64(report.Correct) / float64(report.Total)
+	}
+
+	for _, class := range Labels(report.Confusion) {
+		truePositives := report.Confusion[class][class]
+		support := 0
+		for _, count := range report.Confusion[class] {
+			support += count
+		}
+
+		metrics := ClassMetrics{Support: support}
+		if predictedCounts[class] > 0 {
+			metrics.Precision = float64(truePositives) / float64(predictedCounts[class])
+		}
+		if support > 0 {
+			metrics.Recall = float64(truePositives) / float64(support)
+		}
+		if metrics.Precision+metrics.Recall > 0 {
+			metrics.F1 = 2 * metrics.Precision * metrics.Recall / (metrics.Precision + metrics.Recall)
+		}
+		report.PerClass[class] = metrics
+	}
+
+	return report
+}
+
+// Labels returns every expected or predicted label in a confusion matrix in
+// a stable order, leaving out Unparsed
+func Labels(confusion map[string]map[string]int) []string {
+	seen := make(map[string]bool)
+	for expected, row := range confusion {
+		seen[expected] = true
+		for predicted := range row {
+			if predicted != Unparsed {
+				seen[predicted] = true
+			}
+		}
+	}
+
+	labels := make([]string, 0, len(seen))
+	for label := range seen {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// FormatComparison renders reports side by side followed by each confusion matrix
+func FormatComparison(reports []Report) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%-32s %8s %8s %8s\n", "variant", "accuracy", "correct", "errors")
+	for _, r := range reports {
+		fmt.Fprintf(&b, "%-32s %7.1f%% %5d/%-3d %6d\n", r.Variant, r.Accuracy*100, r.Correct, r.Total, r.Errors)
+	}
+
+	for _, r := range reports {
+		labels := Labels(r.Confusion)
+		columns := append(append([]string{}, labels...), Unparsed)
+
+		fmt.Fprintf(&b, "\n%s\n", r.Variant)
+		fmt.Fprintf(&b, "  %-6s %9s %9s %9s %7s\n", "class", "precision", "recall", "f1", "support")
+		for _, label := range labels {
+			m := r.PerClass[label]
+			fmt.Fprintf(&b, "  %-6s %9.2f %9.2f %9.2f %7d\n", label, m.Precision, m.Recall, m.F1, m.Support)
+		}
+
+		fmt.Fprintf(&b, "  confusion (rows expected, columns predicted)\n  %-6s", "")
+		for _, column := range columns {
+			fmt.Fprintf(&b, " %8s", column)
+		}
+		b.WriteString("\n")
+		for _, label := range labels {
+			fmt.Fprintf(&b, "  %-6s", label)
+			for _, column := range columns {
+				fmt.Fprintf(&b, " %8d", r.Confusion[label][column])
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,84 @@
+package evaluation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dwu006/aita/api"
+	"github.com/dwu006/aita/controller"
+)
+
+// Variant is one judge configuration to evaluate
+type Variant struct {
+	Template string // Judge template version or persona name
+	Model    string
+}
+
+// Name identifies the variant in reports
+func (v Variant) Name() string {
+	return v.Template + "@" + v.Model
+}
+
+// RunOptions controls how the dataset is sent to the judge
+type RunOptions struct {
+	Concurrency   int
+	RatePerSecond float64
+	Collapse      bool // Score on YTA/NTA only, folding ESH into YTA and NAH into NTA
+}
+
+// Run asks the judge variant to rule on every example
+func Run(ctx context.Context, gc *api.GeminiController, examples []Example, variant Variant, opts RunOptions) []Prediction {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.RatePerSecond <= 0 {
+		opts.RatePerSecond = 1
+	}
+
+	limiter := time.NewTicker(time.Duration(float64(time.Second) / opts.RatePerSecond))
+	defer limiter.Stop()
+
+	call := api.CallInfo{Endpoint: "job:eval:" + variant.Name()}
+	predictions := make([]Prediction, len(examples))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				example := examples[i]
+				prediction := Prediction{ExampleID: example.ID, Expected: example.Verdict}
+
+				select {
+				case <-limiter.C:
+					prompt, _ := api.JudgePrompt(variant.Template, example.Title+"\n\n"+example.Body)
+					response, err := gc.GenerateWithModel(call, variant.Model, prompt)
+					if err != nil {
+						prediction.Error = err.Error()
+					} else {
+						prediction.Predicted = api.ParseVerdict(response)
+					}
+				case <-ctx.Done():
+					prediction.Error = ctx.Err().Error()
+				}
+
+				if opts.Collapse {
+					prediction.Expected = controller.VerdictSide(prediction.Expected)
+					prediction.Predicted = controller.VerdictSide(prediction.Predicted)
+				}
+				predictions[i] = prediction
+			}
+		}()
+	}
+
+	for i := range examples {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return predictions
+}
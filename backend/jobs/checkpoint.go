@@ -0,0 +1,51 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dwu006/aita/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Checkpoint records how far a job has progressed so it can resume after
+// being interrupted
+type Checkpoint struct {
+	Key       string               `bson:"_id"`
+	LastID    primitive.ObjectID   `bson:"last_id"`
+	Processed int                  `bson:"processed"`
+	Failed    int                  `bson:"failed"`
+	FailedIDs []primitive.ObjectID `bson:"failed_ids,omitempty"` // Retried on the next run
+	UpdatedAt time.Time            `bson:"updated_at"`
+}
+
+func checkpoints() *mongo.Collection {
+	return db.GetDB().Collection("job_checkpoints")
+}
+
+// LoadCheckpoint returns the saved checkpoint for key, or an empty one
+func LoadCheckpoint(ctx context.Context, key string) (Checkpoint, error) {
+	checkpoint := Checkpoint{Key: key}
+	err := checkpoints().FindOne(ctx, bson.M{"_id": key}).Decode(&checkpoint)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return checkpoint, nil
+	}
+	return checkpoint, err
+}
+
+// SaveCheckpoint stores the checkpoint
+func SaveCheckpoint(ctx context.Context, checkpoint Checkpoint) error {
+	checkpoint.UpdatedAt = time.Now()
+	_, err := checkpoints().ReplaceOne(ctx, bson.M{"_id": checkpoint.Key}, checkpoint, options.Replace().SetUpsert(true))
+	return err
+}
+
+// DeleteCheckpoint forgets a job's progress so the next run starts over
+func DeleteCheckpoint(ctx context.Context, key string) error {
+	_, err := checkpoints().DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
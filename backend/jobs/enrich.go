@@ -0,0 +1,238 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dwu006/aita/api"
+	"github.com/dwu006/aita/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnrichOptions configures a backfill of AI fields on stored posts
+type EnrichOptions struct {
+	Since         time.Time // Only posts created on Reddit after this time
+	Subreddit     string    // Only posts from this subreddit, empty for all
+	Concurrency   int       // Posts enriched in parallel
+	RatePerSecond float64   // Maximum Gemini calls per second across all workers
+	Force         bool      // Re-enrich posts that already have every field
+	Restart       bool      // Ignore any saved checkpoint
+}
+
+// enrichPost is the subset of a stored post the job needs
+type enrichPost struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	PostID     string             `bson:"post_id"`
+	Title      string             `bson:"title"`
+	SelfText   string             `bson:"selftext"`
+	TLDR       string             `bson:"tldr"`
+	Tags       []string           `bson:"tags"`
+	AIJudgment string             `bson:"ai_judgment"`
+}
+
+// RunEnrich walks stored posts in insertion order and fills in missing TLDR,
+// tags and AI judgment fields, saving a checkpoint after every batch. Posts
+// that fail are retried on the next run.
+func RunEnrich(ctx context.Context, gc *api.GeminiController, opts EnrichOptions) error {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.RatePerSecond <= 0 {
+		opts.RatePerSecond = 1
+	}
+
+	key := fmt.Sprintf("enrich:%s:%d", opts.Subreddit, opts.Since.Unix())
+	if opts.Restart {
+		if err := DeleteCheckpoint(ctx, key); err != nil {
+			return fmt.Errorf("failed to reset checkpoint: %w", err)
+		}
+	}
+	checkpoint, err := LoadCheckpoint(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to load checkpoint: %w", err)
+	}
+	if !checkpoint.LastID.IsZero() {
+		fmt.Printf("Resuming from checkpoint after %s (%d processed so far)\n", checkpoint.LastID.Hex(), checkpoint.Processed)
+	}
+
+	filter := bson.M{}
+	if !opts.Since.IsZero() {
+		filter["created_utc"] = bson.M{"$gte": float64(opts.Since.Unix())}
+	}
+	if opts.Subreddit != "" {
+		filter["subreddit"] = opts.Subreddit
+	}
+	if !opts.Force {
+		filter["$or"] = bson.A{
+			bson.M{"tldr": bson.M{"$in": bson.A{nil, ""}}},
+			bson.M{"tags": bson.M{"$in": bson.A{nil, bson.A{}}}},
+			bson.M{"ai_judgment": bson.M{"$in": bson.A{nil, ""}}},
+		}
+	}
+
+	// Share one ticker between workers so the whole job respects the rate
+	limiter := time.NewTicker(time.Duration(float64(time.Second) / opts.RatePerSecond))
+	defer limiter.Stop()
+
+	posts := db.GetDB().Collection("posts")
+	batchSize := int64(opts.Concurrency * 4)
+
+	// Posts that failed on an earlier run sit behind the checkpoint, so retry
+	// them before moving on
+	if retry := checkpoint.FailedIDs; len(retry) > 0 {
+		fmt.Printf("Retrying %d posts that failed before\n", len(retry))
+		retryFilter := bson.M{"_id": bson.M{"$in": retry}}
+		for k, v := range filter {
+			retryFilter[k] = v
+		}
+		cursor, err := posts.Find(ctx, retryFilter)
+		if err != nil {
+			return fmt.Errorf("failed to query posts: %w", err)
+		}
+		var batch []enrichPost
+		if err := cursor.All(ctx, &batch); err != nil {
+			return fmt.Errorf("failed to decode posts: %w", err)
+		}
+
+		checkpoint.Failed -= len(retry)
+		checkpoint.FailedIDs = nil
+		enrichBatch(ctx, gc, limiter.C, batch, opts, &checkpoint)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := SaveCheckpoint(ctx, checkpoint); err != nil {
+			return fmt.Errorf("failed to save checkpoint: %w", err)
+		}
+	}
+
+	for {
+		batchFilter := bson.M{}
+		for k, v := range filter {
+			batchFilter[k] = v
+		}
+		if !checkpoint.LastID.IsZero() {
+			batchFilter["_id"] = bson.M{"$gt": checkpoint.LastID}
+		}
+
+		cursor, err := posts.Find(ctx, batchFilter, options.Find().SetSort(bson.M{"_id": 1}).SetLimit(batchSize))
+		if err != nil {
+			return fmt.Errorf("failed to query posts: %w", err)
+		}
+		var batch []enrichPost
+		if err := cursor.All(ctx, &batch); err != nil {
+			return fmt.Errorf("failed to decode posts: %w", err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		enrichBatch(ctx, gc, limiter.C, batch, opts, &checkpoint)
+
+		// Only move the checkpoint past batches that finished uninterrupted
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		checkpoint.LastID = batch[len(batch)-1].ID
+		if err := SaveCheckpoint(ctx, checkpoint); err != nil {
+			return fmt.Errorf("failed to save checkpoint: %w", err)
+		}
+		fmt.Printf("Enriched %d posts (%d failed)\n", checkpoint.Processed, checkpoint.Failed)
+	}
+
+	fmt.Printf("Enrichment complete: %d posts enriched, %d failed\n", checkpoint.Processed, checkpoint.Failed)
+	return nil
+}
+
+// enrichBatch enriches a batch of posts in parallel, counting them on the
+// checkpoint and recording which failed so a later run retries them
+func enrichBatch(ctx context.Context, gc *api.GeminiController, limiter <-chan time.Time, batch []enrichPost, opts EnrichOptions, checkpoint *Checkpoint) {
+	jobs := make(chan enrichPost)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for post := range jobs {
+				err := enrichOne(ctx, gc, limiter, post, opts.Force)
+
+				mu.Lock()
+				if err != nil {
+					checkpoint.Failed++
+					checkpoint.FailedIDs = append(checkpoint.FailedIDs, post.ID)
+					fmt.Printf("Failed to enrich post %s: %v\n", post.PostID, err)
+				} else {
+					checkpoint.Processed++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, post := range batch {
+		jobs <- post
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// enrichOne generates whichever AI fields a post is missing and stores them
+func enrichOne(ctx context.Context, gc *api.GeminiController, limiter <-chan time.Time, post enrichPost, force bool) error {
+	call := api.CallInfo{Endpoint: "job:enrich"}
+	content := post.Title + "\n\n" + post.SelfText
+	update := bson.M{}
+
+	wait := func() error {
+		select {
+		case <-limiter:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if force || post.TLDR == "" {
+		if err := wait(); err != nil {
+			return err
+		}
+		tldr, err := gc.GenerateResponseFor(call, api.TLDRPrompt(content))
+		if err != nil {
+			return fmt.Errorf("tldr: %w", err)
+		}
+		update["tldr"] = tldr
+	}
+
+	if force || len(post.Tags) == 0 {
+		if err := wait(); err != nil {
+			return err
+		}
+		response, err := gc.GenerateResponseFor(call, api.TagsPrompt(content))
+		if err != nil {
+			return fmt.Errorf("tags: %w", err)
+		}
+		update["tags"] = api.ParseTags(response)
+	}
+
+	if force || post.AIJudgment == "" {
+		if err := wait(); err != nil {
+			return err
+		}
+		judgment, err := gc.GenerateResponseFor(call, api.Personas[api.DefaultPersona].Prompt(content))
+		if err != nil {
+			return fmt.Errorf("judgment: %w", err)
+		}
+		update["ai_judgment"] = judgment
+		update["ai_verdict"] = api.ParseVerdict(judgment)
+	}
+
+	if len(update) == 0 {
+		return nil
+	}
+	update["enriched_at"] = time.Now()
+
+	_, err := db.GetDB().Collection("posts").UpdateOne(ctx, bson.M{"_id": post.ID}, bson.M{"$set": update})
+	return err
+}
@@ -3,6 +3,9 @@ package main
 import (
 	"os"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/dwu006/aita/controller"
@@ -29,6 +32,15 @@ func main() {
 	// Connect to the database first
 	db.Connect(os.Getenv("MONGO_URI"))
 
+	// Run a maintenance command instead of the server, e.g. `aita enrich --since 2025-01-01`
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	rc, err := controller.NewRedditController(
 		os.Getenv("REDDIT_CLIENT_ID"),
 		os.Getenv("REDDIT_CLIENT_SECRET"),
@@ -42,7 +54,9 @@ func main() {
 
 	// Initialize the UserController with a JWT secret
 	jwtSecret := os.Getenv("JWT_SECRET")
-	uc := controller.NewUserController(jwtSecret)
+	uc := controller.NewUserController(jwtSecret, strings.Split(os.Getenv("ADMIN_USERNAMES"), ","))
+	uc.SetEligibilityRules(leaderboardEligibility())
+	uc.ArchiveLeaderboardsEvery(controller.LeaderboardArchiveInterval)
 
 	// Initialize Gemini controller
 	gc, err := api.NewGeminiController()
@@ -51,6 +65,30 @@ func main() {
 		panic(err)
 	}
 
+	// Record Gemini token usage and enforce the per-user daily quota
+	ut := newUsageTracker()
+	gc.SetUsageTracker(ut)
+
+	// Embed catalogued posts with Gemini, keeping the local hashing vectorizer
+	// as a fallback that works without the API
+	embedders := []api.EmbeddingProvider{api.NewHashingEmbedder(1024)}
+	if os.Getenv("EMBEDDING_PROVIDER") != "hashing" {
+		embedders = append([]api.EmbeddingProvider{gc.NewGeminiEmbedder("text-embedding-004")}, embedders...)
+	}
+	catalog := controller.NewPostCatalog(embedders...)
+	catalog.SetVectorIndexes(vectorIndexes())
+
+	// Ask Gemini about posts the regex parser can't read the poster's age or gender from
+	if os.Getenv("DEMOGRAPHICS_LLM_FALLBACK") == "true" {
+		catalog.SetDemographicsFallback(func(title, body string) (*controller.Demographics, error) {
+			response, err := gc.GenerateResponseFor(api.CallInfo{Endpoint: "demographics"}, api.DemographicsPrompt(title, body))
+			if err != nil {
+				return nil, err
+			}
+			return controller.ParseDemographicsJSON(response)
+		})
+	}
+
 	router := gin.Default()
 
 	// Enhanced CORS configuration
@@ -64,11 +102,51 @@ func main() {
 	router.SetTrustedProxies([]string{"127.0.0.1"})
 
 	// Register routes
-	routes.RegisterRedditRoutes(router, rc)
+	routes.RegisterRedditRoutes(router, rc, catalog, uc)
 	routes.RegisterUserRoutes(router, uc)
-	routes.RegisterGeminiRoutes(router, gc)
+	routes.RegisterGeminiRoutes(router, gc, rc, catalog, uc, ut)
+	routes.RegisterExplainRoutes(router, gc, rc, uc, ut, api.NewExplanationCache(7*24*time.Hour))
+	routes.RegisterAdminRoutes(router, uc, ut)
+	routes.RegisterRoomRoutes(router, controller.NewRoomHub(uc), uc)
 
 	fmt.Println("Connected! Listening on http://localhost:8080")
 	// Start the server
 	router.Run(":8080")
 }
+
+// newUsageTracker creates the LLM usage tracker with the configured daily quota
+func newUsageTracker() *api.UsageTracker {
+	dailyQuota, err := strconv.ParseInt(os.Getenv("LLM_DAILY_TOKEN_QUOTA"), 10, 64)
+	if err != nil {
+		dailyQuota = 200000
+	}
+	return api.NewUsageTracker(dailyQuota)
+}
+
+// leaderboardEligibility reads who can be ranked on the accuracy leaderboard,
+// keeping the defaults for anything unset
+func leaderboardEligibility() controller.EligibilityRules {
+	rules := controller.DefaultEligibilityRules
+	if judgments, err := strconv.Atoi(os.Getenv("LEADERBOARD_MIN_JUDGMENTS")); err == nil && judgments >= 0 {
+		rules.MinJudgments = judgments
+	}
+	if days, err := strconv.Atoi(os.Getenv("LEADERBOARD_MIN_ACCOUNT_DAYS")); err == nil && days >= 0 {
+		rules.MinAccountAge = time.Duration(days) * 24 * time.Hour
+	}
+	return rules
+}
+
+// vectorIndexes reads the Atlas vector search index for each embedding
+// provider from VECTOR_SEARCH_INDEXES, e.g.
+// "gemini:text-embedding-004=post_vectors_gemini,hashing=post_vectors_hashing".
+// Providers without one are searched by scanning recent vectors.
+func vectorIndexes() map[string]string {
+	indexes := make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv("VECTOR_SEARCH_INDEXES"), ",") {
+		provider, index, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if ok && provider != "" && index != "" {
+			indexes[provider] = index
+		}
+	}
+	return indexes
+}
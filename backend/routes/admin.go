@@ -0,0 +1,80 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/dwu006/aita/api"
+	"github.com/dwu006/aita/controller"
+)
+
+// RegisterAdminRoutes sets up admin-only reporting routes
+func RegisterAdminRoutes(router *gin.Engine, uc *controller.UserController, ut *api.UsageTracker) {
+	adminRoutes := router.Group("/api/admin")
+	adminRoutes.Use(uc.AuthMiddleware(), uc.AdminMiddleware())
+	{
+		// Summarize LLM token usage and estimated cost, e.g.
+		// /api/admin/llm-usage?from=2025-01-01&to=2025-01-31&group_by=endpoint
+		adminRoutes.GET("/llm-usage", func(c *gin.Context) {
+			groupBy := c.DefaultQuery("group_by", "username")
+			if groupBy != "username" && groupBy != "endpoint" && groupBy != "model" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be one of username, endpoint or model"})
+				return
+			}
+
+			// Default to the last 30 days
+			to := time.Now().UTC()
+			from := to.AddDate(0, 0, -30)
+			if value := c.Query("from"); value != "" {
+				parsed, err := time.Parse("2006-01-02", value)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, expected YYYY-MM-DD"})
+					return
+				}
+				from = parsed
+			}
+			if value := c.Query("to"); value != "" {
+				parsed, err := time.Parse("2006-01-02", value)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, expected YYYY-MM-DD"})
+					return
+				}
+				// Include the whole end day
+				to = parsed.Add(24 * time.Hour)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			summaries, err := ut.Summary(ctx, from, to, groupBy)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to summarize usage", "details": err.Error()})
+				return
+			}
+
+			// Overall totals across all groups
+			var calls int
+			var totalTokens int64
+			var totalCost float64
+			for _, summary := range summaries {
+				calls += summary.Calls
+				totalTokens += summary.TotalTokens
+				totalCost += summary.EstimatedCost
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"from":     from,
+				"to":       to,
+				"group_by": groupBy,
+				"totals": gin.H{
+					"calls":          calls,
+					"total_tokens":   totalTokens,
+					"estimated_cost": totalCost,
+				},
+				"results": summaries,
+			})
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/dwu006/aita/api"
+	"github.com/dwu006/aita/controller"
+)
+
+// maxExplanationExcerpts is how many supporting comments are quoted to the model
+const maxExplanationExcerpts = 5
+
+// RegisterExplainRoutes sets up the route explaining the community's verdict on a post
+func RegisterExplainRoutes(router *gin.Engine, gc *api.GeminiController, rc *controller.RedditController, uc *controller.UserController, ut *api.UsageTracker, ec *api.ExplanationCache) {
+	explainRoutes := router.Group("/api/gemini")
+	explainRoutes.Use(uc.AuthMiddleware(), ut.QuotaMiddleware())
+	{
+		// Explain why Reddit voted the way it did, quoting the top comments
+		explainRoutes.POST("/explain", func(c *gin.Context) {
+			var requestBody struct {
+				PostID  string `json:"post_id" binding:"required"`
+				Verdict string `json:"verdict" binding:"required"`
+			}
+
+			if err := c.ShouldBindJSON(&requestBody); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format", "details": err.Error()})
+				return
+			}
+
+			if requestBody.Verdict != controller.VerdictYTA && requestBody.Verdict != controller.VerdictNTA {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Verdict must be either 'YTA' or 'NTA'"})
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			// Posts in the daily challenge or a duel keep their verdict secret
+			// until the game is over
+			withheld, err := uc.WithheldPosts(ctx)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check posts in play", "details": err.Error()})
+				return
+			}
+			if withheld[requestBody.PostID] {
+				c.JSON(http.StatusForbidden, gin.H{"error": "The verdict on this post is hidden until the game it's in is over"})
+				return
+			}
+
+			// Serve the cached explanation if we already have one
+			if cached, err := ec.Get(ctx, requestBody.PostID, requestBody.Verdict); err != nil {
+				fmt.Println("Failed to read explanation cache:", err)
+			} else if cached != nil {
+				c.JSON(http.StatusOK, gin.H{"cached": true, "result": cached})
+				return
+			}
+
+			post, err := rc.GetPost(requestBody.PostID)
+			if err != nil {
+				c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch post", "details": err.Error()})
+				return
+			}
+
+			counts := controller.CountVerdicts(post.Comments)
+			communityVerdict := controller.CommunityVerdict(counts)
+			if communityVerdict == "" {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "The community hasn't reached a verdict on this post", "vote_counts": counts})
+				return
+			}
+
+			// Comments are ordered by score, so the first matches are the top-voted ones
+			var excerpts []string
+			for _, comment := range post.Comments {
+				if controller.ClassifyVerdict(comment) != communityVerdict {
+					continue
+				}
+				excerpts = append(excerpts, api.Excerpt(comment))
+				if len(excerpts) == maxExplanationExcerpts {
+					break
+				}
+			}
+
+			agreed := controller.VerdictSide(communityVerdict) == requestBody.Verdict
+			prompt := api.ExplainPrompt(post.Title, requestBody.Verdict, communityVerdict, agreed, excerpts)
+
+			summary, err := gc.GenerateResponseFor(callInfo(c), prompt)
+			if err != nil {
+				respondGeminiError(c, "Failed to generate explanation", err)
+				return
+			}
+
+			explanation := &api.Explanation{
+				PostID:           requestBody.PostID,
+				UserVerdict:      requestBody.Verdict,
+				CommunityVerdict: communityVerdict,
+				Agreed:           agreed,
+				Summary:          summary,
+				Excerpts:         excerpts,
+				VoteCounts:       counts,
+				CreatedAt:        time.Now(),
+			}
+			if err := ec.Put(ctx, explanation); err != nil {
+				fmt.Println("Failed to cache explanation:", err)
+			}
+
+			c.JSON(http.StatusOK, gin.H{"cached": false, "result": explanation})
+		})
+	}
+}
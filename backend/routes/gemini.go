@@ -1,39 +1,201 @@
 package routes
 
 import (
+	"context"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/dwu006/aita/api"
+	"github.com/dwu006/aita/controller"
 	"math/rand"
+	"time"
 )
 
+// callInfo attributes a Gemini call to the authenticated user and route
+func callInfo(c *gin.Context) api.CallInfo {
+	return api.CallInfo{
+		Endpoint: c.FullPath(),
+		Username: c.GetString("username"),
+	}
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// respondGeminiError sends an error response whose status tells the client
+// whether the post was blocked, the AI is unavailable or something else failed
+func respondGeminiError(c *gin.Context, message string, err error) {
+	status, code := api.ErrorStatus(err)
+	c.JSON(status, gin.H{"error": message, "code": code, "details": err.Error()})
+}
+
+// tagInBackground stores tags on a post, cataloguing it first if the client
+// fetched it from Reddit directly
+func tagInBackground(rc *controller.RedditController, catalog *controller.PostCatalog, postID string, tags []string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+
+		stored, err := catalog.SetTags(ctx, postID, tags)
+		if err != nil || stored {
+			if err != nil {
+				fmt.Printf("Failed to store tags for post %s: %v\n", postID, err)
+			}
+			return
+		}
+
+		post, err := rc.GetPost(postID)
+		if err != nil {
+			fmt.Printf("Failed to fetch post %s for tagging: %v\n", postID, err)
+			return
+		}
+		if err := catalog.Ingest(ctx, []controller.Post{*post}); err != nil {
+			fmt.Printf("Failed to catalogue post %s: %v\n", postID, err)
+			return
+		}
+		if _, err := catalog.SetTags(ctx, postID, tags); err != nil {
+			fmt.Printf("Failed to store tags for post %s: %v\n", postID, err)
+		}
+	}()
+}
+
 // RegisterGeminiRoutes sets up all Gemini AI-related routes
-func RegisterGeminiRoutes(router *gin.Engine, gc *api.GeminiController) {
+func RegisterGeminiRoutes(router *gin.Engine, gc *api.GeminiController, rc *controller.RedditController, catalog *controller.PostCatalog, uc *controller.UserController, ut *api.UsageTracker) {
+	// Public route to report Gemini availability and circuit breaker state
+	router.GET("/api/gemini/health", func(c *gin.Context) {
+		breaker := gc.BreakerStatus()
+		status := 200
+		if breaker.State == api.BreakerOpen {
+			status = 503
+		}
+		c.JSON(status, gin.H{
+			"available":        breaker.State != api.BreakerOpen,
+			"breaker":          breaker,
+			"cached_responses": gc.CachedResponses(),
+			"blocked":          gc.BlockStats(),
+		})
+	})
+
+	// AI routes require a logged in user so usage can be attributed and capped
 	geminiRoutes := router.Group("/api/gemini")
+	geminiRoutes.Use(uc.AuthMiddleware(), ut.QuotaMiddleware())
 	{
+		// Route to list the AI judge personas and models that can be requested
+		geminiRoutes.GET("/personas", func(c *gin.Context) {
+			personas := make([]api.Persona, 0, len(api.Personas))
+			for _, name := range api.PersonaNames() {
+				personas = append(personas, api.Personas[name])
+			}
+
+			c.JSON(200, gin.H{
+				"default_persona": api.DefaultPersona,
+				"personas":        personas,
+				"default_model":   gc.DefaultModel(),
+				"models":          gc.Models(),
+			})
+		})
+
 		// Route to generate AI responses for YTA/NTA judgments
 		geminiRoutes.POST("/generate", func(c *gin.Context) {
 			// Parse request body
 			var requestBody struct {
-				Input string `json:"input" binding:"required"`
+				Input    string   `json:"input" binding:"required"`
+				Persona  string   `json:"persona"`  // Voice of the judge, defaults to the blunt redditor
+				Ensemble bool     `json:"ensemble"` // Ask several judges and take a majority vote
+				Personas []string `json:"personas"` // Ensemble personas, defaults to all of them
+				Models   []string `json:"models"`   // Ensemble models, defaults to the default model
 			}
 			
 			if err := c.ShouldBindJSON(&requestBody); err != nil {
 				c.JSON(400, gin.H{"error": "Invalid request format", "details": err.Error()})
 				return
 			}
+
+			if requestBody.Ensemble {
+				personas := requestBody.Personas
+				if len(personas) == 0 {
+					personas = api.PersonaNames()
+				}
+				models := requestBody.Models
+				if len(models) == 0 {
+					models = []string{gc.DefaultModel()}
+				}
+
+				// Validate up front so a typo doesn't silently shrink the panel
+				var members []api.EnsembleMember
+				for _, persona := range personas {
+					if _, ok := api.Personas[persona]; !ok {
+						c.JSON(400, gin.H{"error": "Unknown persona", "persona": persona, "available": api.PersonaNames()})
+						return
+					}
+					for _, model := range models {
+						if !containsString(gc.Models(), model) {
+							c.JSON(400, gin.H{"error": "Unknown model", "model": model, "available": gc.Models()})
+							return
+						}
+						members = append(members, api.EnsembleMember{Persona: persona, Model: model})
+					}
+				}
+
+				if err := api.ValidateEnsemble(members); err != nil {
+					c.JSON(400, gin.H{"error": err.Error(), "max_judges": api.MaxEnsembleSize})
+					return
+				}
+
+				result, err := gc.JudgeEnsemble(callInfo(c), requestBody.Input, members)
+				if err != nil {
+					c.JSON(400, gin.H{"error": err.Error()})
+					return
+				}
+				if len(result.Votes) == 0 {
+					c.JSON(502, gin.H{"error": "No judge returned a verdict", "code": "no_verdicts", "verdicts": result.Verdicts})
+					return
+				}
+
+				// Keep "judgment" so existing clients still get a readable answer
+				judgment := "Split decision. The judges couldn't agree."
+				if result.Majority != "" {
+					judgment = fmt.Sprintf("%s. %d of %d judges agree.", result.Majority, result.Votes[result.Majority], len(result.Verdicts))
+				}
+
+				c.JSON(200, gin.H{
+					"judgment":  judgment,
+					"majority":  result.Majority,
+					"agreement": result.Agreement,
+					"votes":     result.Votes,
+					"verdicts":  result.Verdicts,
+				})
+				return
+			}
+
+			personaName := requestBody.Persona
+			if personaName == "" {
+				personaName = api.DefaultPersona
+			}
+			persona, ok := api.Personas[personaName]
+			if !ok {
+				c.JSON(400, gin.H{"error": "Unknown persona", "persona": personaName, "available": api.PersonaNames()})
+				return
+			}
 			
-			// Generate YTA/NTA judgment with explanation
-			ytaPrompt := "Based on the following AITA (Am I The Asshole) post, determine if the poster is YTA (You're The Asshole) or NTA (Not The Asshole). Format your response exactly like this: 'YTA' or 'NTA' followed by a period, then your A 1-2 sentence reason and explanation. Example: 'YTA. You should have communicated better.' or 'NTA. You were reasonable in this situation.'\n\nPost content: " + requestBody.Input
-			
-			response, err := gc.GenerateResponse(ytaPrompt)
+			// Generate YTA/NTA judgment with explanation in the persona's voice
+			response, err := gc.GenerateResponseFor(callInfo(c), persona.Prompt(requestBody.Input))
 			if err != nil {
-				c.JSON(500, gin.H{"error": "Failed to generate response", "details": err.Error()})
+				respondGeminiError(c, "Failed to generate response", err)
 				return
 			}
 			
 			// Return the generated response
 			c.JSON(200, gin.H{
 				"judgment": response,
+				"verdict":  api.ParseVerdict(response),
+				"persona":  persona.Name,
 			})
 		})
 
@@ -50,12 +212,12 @@ func RegisterGeminiRoutes(router *gin.Engine, gc *api.GeminiController) {
 			}
 			
 			// Create a prompt specifically for generating a TLDR
-			tldrPrompt := "Generate a ONE SENTENCE ONLY BRIEF AND CONCISE TLDR (Too Long; Didn't Read) summary of this post: " + requestBody.PostContent
+			tldrPrompt := api.TLDRPrompt(requestBody.PostContent)
 			
 			// Generate response using Gemini
-			response, err := gc.GenerateResponse(tldrPrompt)
+			response, err := gc.GenerateResponseFor(callInfo(c), tldrPrompt)
 			if err != nil {
-				c.JSON(500, gin.H{"error": "Failed to generate TLDR", "details": err.Error()})
+				respondGeminiError(c, "Failed to generate TLDR", err)
 				return
 			}
 			
@@ -95,26 +257,43 @@ func RegisterGeminiRoutes(router *gin.Engine, gc *api.GeminiController) {
 			// Parse request body
 			var requestBody struct {
 				Content string `json:"content" binding:"required"`
+				PostID  string `json:"post_id"` // Optional, stores the tags with the post
 			}
 			
 			if err := c.ShouldBindJSON(&requestBody); err != nil {
 				c.JSON(400, gin.H{"error": "Invalid request format", "details": err.Error()})
 				return
 			}
+
+			// Reuse tags already stored with the post
+			if requestBody.PostID != "" {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				post, err := catalog.FindPost(ctx, requestBody.PostID)
+				cancel()
+				if err == nil && len(post.Tags) > 0 {
+					c.JSON(200, gin.H{"tags": post.Tags})
+					return
+				}
+			}
 			
 			// Create a prompt for generating tags
-			tagsPrompt := "Given the following text, choose 1-2 relevant category tags from this list ONLY: [Relationships, Work, Money, Roommates, Friends, School, Weddings, Parenting, In-Laws, Public, Revenge, Neighbors]. Format your response as a JSON array of strings, e.g. [\"Relationships\", \"Friends\"]. Don't include any other text in your response. Again only from the list. Here's the content: " + requestBody.Content
+			tagsPrompt := api.TagsPrompt(requestBody.Content)
 			
 			// Generate response using Gemini
-			response, err := gc.GenerateResponse(tagsPrompt)
+			response, err := gc.GenerateResponseFor(callInfo(c), tagsPrompt)
 			if err != nil {
-				c.JSON(500, gin.H{"error": "Failed to generate tags", "details": err.Error()})
+				respondGeminiError(c, "Failed to generate tags", err)
 				return
 			}
+
+			tags := api.ParseTags(response)
+			if requestBody.PostID != "" && len(tags) > 0 {
+				tagInBackground(rc, catalog, requestBody.PostID, tags)
+			}
 			
 			// Return the generated tags
 			c.JSON(200, gin.H{
-				"tags": response,
+				"tags": tags,
 			})
 		})
 	}
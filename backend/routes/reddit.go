@@ -1,13 +1,32 @@
 package routes
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"strconv"
+	"time"
 	
 	"github.com/gin-gonic/gin"
 	"github.com/dwu006/aita/controller"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func RegisterRedditRoutes(router *gin.Engine, rc *controller.RedditController) {
+// ingestInBackground catalogues fetched posts without delaying the response
+func ingestInBackground(catalog *controller.PostCatalog, posts []controller.Post) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+
+		if err := catalog.Ingest(ctx, posts); err != nil {
+			fmt.Println("Failed to catalogue posts:", err)
+		}
+	}()
+}
+
+// RegisterRedditRoutes serves posts. Verdicts on posts that are in play in a
+// game are withheld, so they can't be looked up here.
+func RegisterRedditRoutes(router *gin.Engine, rc *controller.RedditController, catalog *controller.PostCatalog, uc *controller.UserController) {
 	redditRoutes := router.Group("/api/posts")
 	{
 		redditRoutes.GET("/:subreddit", func(c *gin.Context) {
@@ -21,10 +40,24 @@ func RegisterRedditRoutes(router *gin.Engine, rc *controller.RedditController) {
 				return
 			}
 
+			for i := range posts {
+				if posts[i].Subreddit == "" {
+					posts[i].Subreddit = subreddit
+				}
+			}
+			ingestInBackground(catalog, posts)
+
+			// Ingesting keeps using posts, so withhold verdicts on a copy
+			results := append([]controller.Post(nil), posts...)
+			if err := uc.WithholdVerdicts(c.Request.Context(), results); err != nil {
+				c.JSON(500, gin.H{"error": "Failed to check posts in play", "details": err.Error()})
+				return
+			}
+
 			c.JSON(200, gin.H{
 				"subreddit": subreddit,
-				"count":     len(posts),
-				"results":   posts,
+				"count":     len(results),
+				"results":   results,
 			})
 		})
 		
@@ -38,7 +71,142 @@ func RegisterRedditRoutes(router *gin.Engine, rc *controller.RedditController) {
 				return
 			}
 			
-			c.JSON(200, post)
+			ingestInBackground(catalog, []controller.Post{*post})
+
+			results := []controller.Post{*post}
+			if err := uc.WithholdVerdicts(c.Request.Context(), results); err != nil {
+				c.JSON(500, gin.H{"error": "Failed to check posts in play", "details": err.Error()})
+				return
+			}
+
+			c.JSON(200, results[0])
+		})
+
+		// Browse the catalogue, optionally filtered by who is in the post or how
+		// hard it is, and ordered newest or by difficulty
+		redditRoutes.GET("/catalog", func(c *gin.Context) {
+			limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+			if err != nil || limit < 1 || limit > 100 {
+				c.JSON(400, gin.H{"error": "limit must be between 1 and 100"})
+				return
+			}
+			offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+			if err != nil || offset < 0 {
+				c.JSON(400, gin.H{"error": "offset must be a non-negative integer"})
+				return
+			}
+			minAge, _ := strconv.Atoi(c.Query("min_age"))
+			maxAge, _ := strconv.Atoi(c.Query("max_age"))
+			minDifficulty, _ := strconv.ParseFloat(c.Query("min_difficulty"), 64)
+			maxDifficulty, _ := strconv.ParseFloat(c.Query("max_difficulty"), 64)
+			sort := c.DefaultQuery("sort", controller.SortNewest)
+			if sort != controller.SortNewest && sort != controller.SortHardest && sort != controller.SortEasiest {
+				c.JSON(400, gin.H{"error": "sort must be one of newest, hardest or easiest"})
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			posts, err := catalog.ListPosts(ctx, controller.PostFilter{
+				Subreddit:     c.Query("subreddit"),
+				PosterGender:  c.Query("poster_gender"),
+				MinAge:        minAge,
+				MaxAge:        maxAge,
+				Relationship:  c.Query("relationship"),
+				MinDifficulty: minDifficulty,
+				MaxDifficulty: maxDifficulty,
+				Sort:          sort,
+				Limit:         limit,
+				Offset:        offset,
+			})
+			if err != nil {
+				c.JSON(500, gin.H{"error": "Failed to list posts", "details": err.Error()})
+				return
+			}
+			if err := uc.WithholdVerdicts(ctx, posts); err != nil {
+				c.JSON(500, gin.H{"error": "Failed to check posts in play", "details": err.Error()})
+				return
+			}
+
+			c.JSON(200, gin.H{
+				"count":   len(posts),
+				"results": posts,
+			})
+		})
+
+		// Community verdicts broken down by poster gender, age or relationship
+		redditRoutes.GET("/analytics/demographics", func(c *gin.Context) {
+			dimension := c.DefaultQuery("dimension", "poster_gender")
+			if !containsString(controller.DemographicsDimensions, dimension) {
+				c.JSON(400, gin.H{"error": "Invalid dimension", "available": controller.DemographicsDimensions})
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			buckets, err := catalog.DemographicsBreakdown(ctx, dimension)
+			if err != nil {
+				c.JSON(500, gin.H{"error": "Failed to compute demographics", "details": err.Error()})
+				return
+			}
+
+			c.JSON(200, gin.H{
+				"dimension": dimension,
+				"results":   buckets,
+			})
+		})
+
+		// Recommend catalogued posts similar to this one
+		redditRoutes.GET("/id/:postId/similar", func(c *gin.Context) {
+			postID := c.Param("postId")
+			limit, err := strconv.Atoi(c.DefaultQuery("limit", "5"))
+			if err != nil || limit < 1 || limit > 50 {
+				c.JSON(400, gin.H{"error": "limit must be between 1 and 50"})
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			// Catalogue the post first if we haven't seen it yet
+			if _, err := catalog.FindPost(ctx, postID); errors.Is(err, mongo.ErrNoDocuments) {
+				post, err := rc.GetPost(postID)
+				if err != nil {
+					c.JSON(500, gin.H{"error": err.Error()})
+					return
+				}
+				if err := catalog.Ingest(ctx, []controller.Post{*post}); err != nil {
+					c.JSON(500, gin.H{"error": "Failed to catalogue post", "details": err.Error()})
+					return
+				}
+			} else if err != nil {
+				c.JSON(500, gin.H{"error": "Failed to look up post", "details": err.Error()})
+				return
+			}
+
+			similar, err := catalog.Similar(ctx, postID, limit)
+			if err != nil {
+				c.JSON(500, gin.H{"error": "Failed to find similar posts", "details": err.Error()})
+				return
+			}
+			withheld, err := uc.WithheldPosts(ctx)
+			if err != nil {
+				c.JSON(500, gin.H{"error": "Failed to check posts in play", "details": err.Error()})
+				return
+			}
+			for i := range similar {
+				if withheld[similar[i].PostID] {
+					similar[i].CommunityVerdict = ""
+				}
+			}
+
+			c.JSON(200, gin.H{
+				"id":      postID,
+				"count":   len(similar),
+				"results": similar,
+			})
 		})
 	}
 }
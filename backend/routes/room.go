@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/dwu006/aita/controller"
+)
+
+// RegisterRoomRoutes sets up multiplayer room routes
+func RegisterRoomRoutes(router *gin.Engine, hub *controller.RoomHub, uc *controller.UserController) {
+	roomRoutes := router.Group("/api/rooms")
+	roomRoutes.Use(uc.AuthMiddleware())
+	{
+		roomRoutes.POST("", hub.CreateRoom)       // Open a room and get its code
+		roomRoutes.GET("/:code", hub.GetRoom)     // Who's in a room
+		roomRoutes.GET("/:code/ws", hub.JoinRoom) // Play in a room over a WebSocket, offering the "bearer" and token subprotocols if headers can't be set
+	}
+}
@@ -24,14 +24,56 @@ func RegisterUserRoutes(router *gin.Engine, uc *controller.UserController) {
 		// For example:
 		userRoutes.GET("/profile", uc.FetchUser)
 		userRoutes.PUT("/update", uc.UpdateUser)
+		userRoutes.PUT("/timezone", uc.SetTimezone)
 		userRoutes.POST("/post-history", uc.AddPostToHistory) // Add post to user's history
 		userRoutes.POST("/update-stats", uc.UpdateUserStats)  // Update user's accuracy stats
+		userRoutes.GET("/history", uc.GetHistory)             // Paginated judgment history
+		userRoutes.GET("/activity", uc.GetActivity)           // Judgments per day for a year
+		userRoutes.GET("/achievements", uc.GetAchievements)   // Earned and available achievements
+		userRoutes.PUT("/history/:postId", uc.ChangeJudgment)         // Change the verdict on a judged post
+		userRoutes.POST("/history/:postId/undo", uc.UndoJudgment)     // Undo a judgment within the undo window
 	}
 
 	// Leaderboard routes - protected by auth middleware
 	leaderboardRoutes := router.Group("/api/users")
 	leaderboardRoutes.Use(uc.AuthMiddleware())
 	{
-		leaderboardRoutes.GET("/leaderboard", uc.GetLeaderboard) // Get user rankings
+		leaderboardRoutes.GET("/leaderboard", uc.GetLeaderboard)                 // Get user rankings, optionally for a period or friends
+		leaderboardRoutes.GET("/leaderboard/winners", uc.GetLeaderboardWinners) // Winners of past periods
+	}
+
+	// Social routes - following, friends and what friends have judged
+	socialRoutes := router.Group("/api/social")
+	socialRoutes.Use(uc.AuthMiddleware())
+	{
+		socialRoutes.GET("", uc.GetSocial)                                       // Following, followers, friends and requests
+		socialRoutes.GET("/feed", uc.GetFriendFeed)                              // Friends' judgments on posts you've judged
+		socialRoutes.POST("/follow/:username", uc.Follow)                        // Follow a user
+		socialRoutes.DELETE("/follow/:username", uc.Unfollow)                    // Unfollow, ending any friendship
+		socialRoutes.POST("/friends/:username", uc.SendFriendRequest)            // Follow and ask to be followed back
+		socialRoutes.POST("/friends/:username/accept", uc.AcceptFriendRequest)   // Follow back
+		socialRoutes.POST("/friends/:username/decline", uc.DeclineFriendRequest) // Turn down a request
+		socialRoutes.DELETE("/friends/:username", uc.Unfollow)                   // Unfriend
+	}
+
+	// Duel routes - two players judge the same posts head to head
+	duelRoutes := router.Group("/api/duels")
+	duelRoutes.Use(uc.AuthMiddleware())
+	{
+		duelRoutes.POST("", uc.CreateDuel)              // Challenge another player
+		duelRoutes.GET("", uc.GetDuels)                 // Your duels and win/loss record
+		duelRoutes.GET("/:id", uc.GetDuel)              // A duel and its posts
+		duelRoutes.POST("/:id/accept", uc.AcceptDuel)   // Accept a challenge
+		duelRoutes.POST("/:id/decline", uc.DeclineDuel) // Decline a challenge
+		duelRoutes.POST("/:id/submit", uc.SubmitDuel)   // Answer the duel's posts
+	}
+
+	// Daily challenge routes - the same posts for every player each day
+	dailyRoutes := router.Group("/api/daily")
+	dailyRoutes.Use(uc.AuthMiddleware())
+	{
+		dailyRoutes.GET("", uc.GetDailyChallenge)               // Today's posts, with results once played
+		dailyRoutes.POST("/submit", uc.SubmitDailyChallenge)    // One attempt per day
+		dailyRoutes.GET("/leaderboard", uc.GetDailyLeaderboard) // Rankings for a day
 	}
 }
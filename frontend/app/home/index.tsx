@@ -310,7 +310,7 @@ export default function Home() {
         let categories = [];
         try {
           // Generate AI tags
-          const aiTags = await generateTags(postContent);
+          const aiTags = await generateTags(postContent, child.data.id);
           console.log("AI generated tags:", aiTags);
           
           categories = aiTags;
@@ -423,7 +423,7 @@ export default function Home() {
   };
 
   // Function to generate tags for a post using AI
-  const generateTags = async (postContent: string): Promise<string[]> => {
+  const generateTags = async (postContent: string, postId: string): Promise<string[]> => {
     try {
       const baseUrl = getBaseUrl();
       const response = await fetch(`${baseUrl}/api/gemini/generate-tags`, {
@@ -433,7 +433,8 @@ export default function Home() {
           'Authorization': `Bearer ${await AsyncStorage.getItem('authToken')}`
         },
         body: JSON.stringify({
-          content: postContent
+          content: postContent,
+          post_id: postId
         }),
       });
       
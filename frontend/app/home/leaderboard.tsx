@@ -61,7 +61,7 @@ export default function LeaderboardScreen() {
       }
 
       console.log(`Fetching leaderboard data with sort=${sortBy}`);
-      // Fetch real users from the API - Note: API directly returns array of users
+      // Fetch a page of ranked users from the API
       const response = await fetch(`${getBaseUrl()}/api/users/leaderboard?sort=${sortBy}`, {
         method: 'GET',
         headers: {
@@ -87,18 +87,18 @@ export default function LeaderboardScreen() {
       const data = await response.json();
       console.log('Leaderboard data received:', data);
       
-      // Check if data is valid (should be an array)
-      if (data && Array.isArray(data)) {
-        console.log(`Received ${data.length} users from API`);
-        // Add rank to each user, handle missing/null values
-        const rankedData = data.map((user: any, index: number) => ({
+      // Check if data is valid (ranked users are in results)
+      if (data && Array.isArray(data.results)) {
+        console.log(`Received ${data.results.length} of ${data.total} users from API`);
+        // Handle missing/null values, keeping the rank from the server
+        const rankedData = data.results.map((user: any, index: number) => ({
           id: user._id || user.id || `user-${index}`,
           username: user.username || 'anonymous',
           name: user.name || 'Anonymous User',
           pfp: user.pfp || 'https://randomuser.me/api/portraits/lego/1.jpg',
           accuracy: typeof user.accuracy === 'number' ? user.accuracy : 0,
           num_posts: typeof user.num_posts === 'number' ? user.num_posts : 0,
-          rank: index + 1
+          rank: typeof user.rank === 'number' ? user.rank : index + 1
         }));
 
         setLeaderboardData(rankedData);
@@ -226,6 +226,7 @@ export default function LoginScreen(props: LoginScreenProps) {
           username: registerUsername,
           name: registerName,
           password: registerPassword,
+          timezone: Intl.DateTimeFormat().resolvedOptions().timeZone,
         }),
       });
       